@@ -0,0 +1,247 @@
+// Command oidc-client is a fake OpenID Connect client for trying the API's
+// provider locally. It logs in with an email and password, runs the
+// authorization code flow with PKCE against the discovered endpoints,
+// verifies the ID token against the JWKS and prints the userinfo response.
+//
+//	go run ./cmd/oidc-client -client-id oc_... -email me@example.com -pass secret
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type idClaims struct {
+	Nonce string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// the authorization redirect is read, not followed
+var client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+func main() {
+	issuer := flag.String("issuer", "http://localhost:3000", "provider base URL")
+	clientID := flag.String("client-id", "", "registered client ID")
+	clientSecret := flag.String("client-secret", "", "client secret, for confidential clients")
+	redirectURI := flag.String("redirect-uri", "http://localhost:8081/callback", "a redirect URI registered for the client")
+	scope := flag.String("scope", "openid profile email", "scopes to request")
+	email := flag.String("email", "", "account email")
+	pass := flag.String("pass", "", "account password")
+	flag.Parse()
+	if *clientID == "" || *email == "" || *pass == "" {
+		flag.Usage()
+		log.Fatal("-client-id, -email and -pass are required")
+	}
+
+	var disc discovery
+	must(getJSON(*issuer+"/.well-known/openid-configuration", "", &disc))
+	fmt.Println("discovered issuer", disc.Issuer)
+
+	// 1. the user signs in to the bookstore
+	var login struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+	}
+	must(postJSON(*issuer+"/api/login", map[string]string{"email": *email, "pass": *pass}, &login))
+	if login.MFARequired {
+		log.Fatal("this account uses two-factor login, try one without")
+	}
+
+	// 2. the client sends the user to the authorization endpoint
+	verifier := randomString(32)
+	sum := sha256.Sum256([]byte(verifier))
+	state, nonce := randomString(16), randomString(16)
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {*clientID},
+		"redirect_uri":          {*redirectURI},
+		"scope":                 {*scope},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	req, _ := http.NewRequest(http.MethodGet, disc.AuthorizationEndpoint+"?"+q.Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	res, err := client.Do(req)
+	must(err)
+	res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusFound || err != nil {
+		log.Fatalf("authorize: expected a redirect, got %s", res.Status)
+	}
+	callback := location.Query()
+	if e := callback.Get("error"); e != "" {
+		log.Fatalf("authorize: %s: %s", e, callback.Get("error_description"))
+	}
+	if callback.Get("state") != state {
+		log.Fatal("authorize: state does not match")
+	}
+	fmt.Println("got authorization code at", location.Scheme+"://"+location.Host+location.Path)
+
+	// 3. the client exchanges the code
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {callback.Get("code")},
+		"redirect_uri":  {*redirectURI},
+		"code_verifier": {verifier},
+	}
+	if *clientSecret == "" {
+		form.Set("client_id", *clientID) // public client
+	}
+	req, _ = http.NewRequest(http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if *clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(*clientID), url.QueryEscape(*clientSecret))
+	}
+	var tokens tokenResponse
+	must(doJSON(req, &tokens))
+	fmt.Printf("got tokens with scope %q, expiring in %ds\n", tokens.Scope, tokens.ExpiresIn)
+
+	// 4. the client verifies the ID token
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	must(getJSON(disc.JWKSURI, "", &set))
+	var claims idClaims
+	if len(set.Keys) == 0 {
+		// HS256 tokens can only be checked with the API's secret
+		fmt.Println("the provider publishes no keys, skipping the ID token signature check")
+		_, _, err = jwt.NewParser().ParseUnverified(tokens.IDToken, &claims)
+	} else {
+		_, err = jwt.ParseWithClaims(tokens.IDToken, &claims, keyfunc(set.Keys),
+			jwt.WithIssuer(disc.Issuer), jwt.WithAudience(*clientID), jwt.WithExpirationRequired())
+	}
+	must(err)
+	if claims.Nonce != nonce {
+		log.Fatal("id token: nonce does not match")
+	}
+	fmt.Println("ID token is valid for user", claims.Subject)
+
+	// 5. the client asks who the user is
+	var info map[string]any
+	must(getJSON(disc.UserinfoEndpoint, tokens.AccessToken, &info))
+	out, _ := json.MarshalIndent(info, "", "  ")
+	fmt.Println("userinfo:", string(out))
+}
+
+// keyfunc picks the published key named by the token's kid.
+func keyfunc(keys []jwk) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, k := range keys {
+			if k.Kid != kid {
+				continue
+			}
+			switch k.Kty {
+			case "OKP":
+				x, err := base64.RawURLEncoding.DecodeString(k.X)
+				return ed25519.PublicKey(x), err
+			case "RSA":
+				n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+				e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+				if err := errors.Join(err1, err2); err != nil {
+					return nil, err
+				}
+				return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+			}
+		}
+		return nil, fmt.Errorf("no published key for kid %q", kid)
+	}
+}
+
+func getJSON(url, bearer string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return doJSON(req, out)
+}
+
+func postJSON(url string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(req, out)
+}
+
+func doJSON(req *http.Request, out any) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, res.Status, data)
+	}
+	return json.Unmarshal(data, out)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -23,7 +23,8 @@ func InitDB() (*gorm.DB, error) {
 
 	//dsn yaane data source name
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=True&loc=Local", user, pass, host, port, name, charset)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{}) //&gorm.Config{} is just default config of gorm
+	// TranslateError maps driver errors such as duplicate keys to gorm.ErrDuplicatedKey
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
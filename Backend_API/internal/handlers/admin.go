@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"first_task/go-fiber-api/internal/middleware"
+	"first_task/go-fiber-api/internal/models"
+	"first_task/go-fiber-api/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	TokenSvc    *services.TokenService
+	UserService *services.UserService
+	Audit       *services.AuditService
+}
+
+func NewAdminHandler(ts *services.TokenService, us *services.UserService, audit *services.AuditService) *AdminHandler {
+	return &AdminHandler{TokenSvc: ts, UserService: us, Audit: audit}
+}
+
+// Impersonate godoc
+// @Summary Impersonate a user
+// @Description Issue a short-lived, read-only access token for the user, carrying the admin in its act claim. Changes made with it are refused and every request is audit-logged. Admins cannot be impersonated.
+// @Tags admin
+// @Produce  json
+// @Param   userId  path  int  true  "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/impersonate/{userId} [post]
+func (h *AdminHandler) Impersonate(c *fiber.Ctx) error {
+	adminID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	id, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if id == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "you cannot impersonate yourself",
+		})
+	}
+	target, err := h.UserService.GetUserByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if target.Role == models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "admins cannot be impersonated",
+		})
+	}
+
+	token, err := h.TokenSvc.CreateImpersonationToken(target, adminID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not create token",
+		})
+	}
+	if err := h.Audit.Record(&models.AuditLog{
+		Action:    models.AuditImpersonate,
+		ActorID:   adminID,
+		SubjectID: target.ID,
+		Method:    c.Method(),
+		Path:      c.OriginalURL(),
+		Status:    fiber.StatusOK,
+		IP:        c.IP(),
+	}); err != nil {
+		log.Printf("could not write audit log entry for admin %d: %v", adminID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"token":         token,
+		"expires_in":    int(services.ImpersonationTTL.Seconds()),
+		"impersonating": target.ID,
+	})
+}
+
+// GetAuditLog godoc
+// @Summary List the impersonation audit log
+// @Description Retrieve the newest audit entries, optionally only those of one admin (admins only)
+// @Tags admin
+// @Produce  json
+// @Param   actor_id  query  int  false  "Only entries of this admin"
+// @Param   limit     query  int  false  "Maximum number of entries (default and max 500)"
+// @Success 200 {array} models.AuditLog
+// @Router /admin/audit-log [get]
+func (h *AdminHandler) GetAuditLog(c *fiber.Ctx) error {
+	entries, err := h.Audit.GetEntries(c.QueryInt("actor_id"), c.QueryInt("limit"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not load audit log",
+		})
+	}
+	return c.JSON(entries)
+}
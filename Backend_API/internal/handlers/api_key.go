@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	utils "first_task/go-fiber-api/pkg"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type APIKeyHandler struct {
+	Service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(s *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{Service: s}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"` // optional, RFC 3339
+}
+
+// ListAPIKeys godoc
+// @Summary List your API keys
+// @Description Retrieve the caller's API keys, revoked ones included. Only their prefixes are shown.
+// @Tags api-keys
+// @Produce  json
+// @Success 200 {array} models.APIKey
+// @Router /users/me/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	keys, err := h.Service.GetAPIKeysByUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve api keys",
+		})
+	}
+	return c.JSON(keys)
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Issue a personal API key for scripts, used as "Authorization: ApiKey <key>". Scopes default to everything the caller's role allows. The key is only shown in this response.
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param   body  body  CreateAPIKeyRequest  true  "API Key"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users/me/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	// a leaked key must not be able to mint more keys
+	if user.APIKeyID != 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "api keys cannot create api keys, log in instead",
+		})
+	}
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	owner := models.User{ID: user.ID, Role: user.Role}
+	key, record, err := h.Service.CreateAPIKey(&owner, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyNameEmpty) || errors.Is(err, services.ErrAPIKeyExpiry) ||
+			errors.Is(err, services.ErrInvalidScope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create api key",
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "store this key now, it cannot be shown again",
+		"key":     key,
+		"api_key": record,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the caller's API keys; it stops working immediately
+// @Tags api-keys
+// @Produce  json
+// @Param   id  path  int  true  "API Key ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/me/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API Key",
+		})
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if err := h.Service.RevokeAPIKey(id, userID); err != nil {
+		if errors.Is(err, repo.ErrAPIKeyNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "API key not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke api key",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
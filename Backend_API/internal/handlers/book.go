@@ -4,11 +4,15 @@ package handlers
 //call respective service
 //return response
 import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
 	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
 	"first_task/go-fiber-api/internal/services"
 	utils "first_task/go-fiber-api/pkg"
 	"fmt"
 	"html"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -24,7 +28,7 @@ type BookHandler struct {
 }
 
 // @Summary Create a new book
-// @Description Add a new book to the store
+// @Description Add a new book to the store. The caller becomes its publisher unless an admin sets publisher_id.
 // @Tags books
 // @Accept  json
 // @Produce  json
@@ -40,6 +44,16 @@ func (B *BookHandler) CreateBook(c *fiber.Ctx) error {
 			"error": "Failed to parse request body",
 		}) //fiber.Map is just a shorthand for map[string]interface{} map[KeyType]ValueType
 	}
+	//books belong to the caller; only admins may publish on someone else's behalf
+	callerID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if book.PublisherID == 0 || middleware.CurrentRole(c) != models.RoleAdmin {
+		book.PublisherID = callerID
+	}
 	//2 service call
 	if err := B.Service.CreateBook(&book); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -54,28 +68,50 @@ func (B *BookHandler) CreateBook(c *fiber.Ctx) error {
 }
 
 // @Summary Get all books
-// @Description Retrieve all books from the store
+// @Description Retrieve one page of books from the store, filtered and sorted. Pages are addressed by next_cursor, or by page number when page is set. Admins can add ?include_deleted=true to see deleted books too. Without format=json the response is an HTML fragment for htmx with a "load more" control.
 // @Tags books
 // @Produce  json
-// @Success 200 {array} models.Book
+// @Param   search           query  string  false  "Title or genre contains"
+// @Param   genre            query  string  false  "Exact genre"
+// @Param   publisher_id     query  int     false  "Publisher"
+// @Param   year_from        query  int     false  "Published in or after"
+// @Param   year_to          query  int     false  "Published in or before"
+// @Param   available        query  bool    false  "Only books with copies on the shelf"
+// @Param   sort             query  string  false  "title, published_year or quantity; prefix with - for descending"
+// @Param   limit            query  int     false  "Page size (default 20, max 100)"
+// @Param   cursor           query  string  false  "next_cursor of the previous page"
+// @Param   page             query  int     false  "1-based page number, instead of cursor"
+// @Param   include_deleted  query  bool    false  "Include deleted books (admins only)"
+// @Success 200 {object} services.BookPage
+// @Failure 400 {object} map[string]string
 // @Router /books [get]
-//
-//	func (B *BookHandler) GetAllBooks(c *fiber.Ctx) error {
-//		books, err := B.Service.GetAllBooks()
-//		if err != nil {
-//			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-//				"error": "Failed to retrieve books",
-//			})
-//		}
-//		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-//			"books": books,
-//		})
-//	}
 func (B *BookHandler) GetAllBooks(c *fiber.Ctx) error {
-	search := c.Query("search", "")
+	params := services.BookListParams{
+		Search:         c.Query("search", ""),
+		Genre:          c.Query("genre"),
+		PublisherID:    c.QueryInt("publisher_id"),
+		YearFrom:       c.QueryInt("year_from"),
+		YearTo:         c.QueryInt("year_to"),
+		Available:      c.QueryBool("available"),
+		IncludeDeleted: c.QueryBool("include_deleted"),
+		Sort:           c.Query("sort"),
+		Limit:          c.QueryInt("limit"),
+		Page:           c.QueryInt("page"),
+		Cursor:         c.Query("cursor"),
+	}
+	if params.IncludeDeleted && middleware.CurrentRole(c) != models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only admins can see deleted books",
+		})
+	}
 
-	books, err := B.Service.GetAllBooksFiltered(search)
+	page, err := B.Service.ListBooks(params)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidBookSort) || errors.Is(err, services.ErrInvalidBookCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve books",
 		})
@@ -83,35 +119,83 @@ func (B *BookHandler) GetAllBooks(c *fiber.Ctx) error {
 
 	// if user explicitly wants JSON: /api/books?format=json
 	if c.Query("format") == "json" {
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"books": books,
-		})
+		return c.Status(fiber.StatusOK).JSON(page)
 	}
 
-	// build a simple Bootstrap grid of cards
+	// build a simple Bootstrap grid of cards; later pages only add cards
+	// and a new "load more" control in place of the old one
 	var sb strings.Builder
-	sb.WriteString(`<div class="row g-3">`)
+	firstPage := params.Cursor == "" && params.Page <= 1
+	if firstPage {
+		sb.WriteString(`<div class="row g-3">`)
+	}
 
-	if len(books) == 0 {
+	if len(page.Books) == 0 && firstPage {
 		sb.WriteString(`<div class="col-12"><div class="alert alert-warning mb-0">No books found.</div></div>`)
 	} else {
-		for _, book := range books {
-			// fallback image
-			img := book.Img_url
-			if img == "" {
-				img = "https://via.placeholder.com/150x220?text=No+Cover"
+		for i := range page.Books {
+			sb.WriteString(bookCard(&page.Books[i], ""))
+		}
+	}
+
+	if page.NextCursor != "" {
+		// same filters and sort, continuing after the last card
+		query := url.Values{}
+		for key, value := range c.Queries() {
+			if key != "cursor" && key != "page" {
+				query.Set(key, value)
 			}
+		}
+		query.Set("cursor", page.NextCursor)
+		next := c.BaseURL() + c.Path() + "?" + query.Encode()
+		sb.WriteString(fmt.Sprintf(`
+                <div class="col-12 text-center">
+                  <button class="btn btn-outline-primary"
+                          type="button"
+                          hx-get="%s"
+                          hx-target="closest div"
+                          hx-swap="outerHTML">
+                    Load more <small class="text-muted">(%d books in total)</small>
+                  </button>
+                </div>
+            `, html.EscapeString(next), page.Total))
+	}
 
-			// escape user-provided strings to avoid injecting HTML
-			title := html.EscapeString(book.Title)
-			genre := html.EscapeString(book.Genre)
+	if firstPage {
+		sb.WriteString(`</div>`) // close row
+	}
 
-			sb.WriteString(fmt.Sprintf(`
+	// Return HTML fragment (suitable for htmx hx-get)
+	return c.Status(fiber.StatusOK).Type("html").SendString(sb.String())
+}
+
+// bookCard renders a book as a Bootstrap card for the htmx grid. snippet is
+// trusted HTML from the search index and may be empty.
+func bookCard(book *models.Book, snippet string) string {
+	// fallback image
+	img := book.Img_url
+	if img == "" {
+		img = "https://via.placeholder.com/150x220?text=No+Cover"
+	}
+
+	// escape user-provided strings to avoid injecting HTML
+	title := html.EscapeString(book.Title)
+	genre := html.EscapeString(book.Genre)
+	extra := ""
+	if book.Author != "" {
+		extra += fmt.Sprintf(`<p class="card-text mb-1"><small class="text-muted">By %s</small></p>`, html.EscapeString(book.Author))
+	}
+	if snippet != "" {
+		extra += fmt.Sprintf(`<p class="card-text mb-2 small">%s</p>`, snippet)
+	}
+
+	return fmt.Sprintf(`
                 <div class="col-12 col-sm-6 col-md-4 col-lg-3">
                   <div class="card h-100">
                     <img src="%s" class="card-img-top" alt="%s cover" style="height:220px; object-fit:cover;">
                     <div class="card-body d-flex flex-column">
                       <h5 class="card-title">%s</h5>
+                      %s
                       <p class="card-text mb-1"><small class="text-muted">Genre: %s</small></p>
                       <p class="card-text mb-2"><small class="text-muted">Published: %d • Qty: %d</small></p>
                       <div class="mt-auto">
@@ -128,13 +212,51 @@ func (B *BookHandler) GetAllBooks(c *fiber.Ctx) error {
                     </div>
                   </div>
                 </div>
-            `, img, title, title, genre, book.PublishedYear, book.Quantity, book.ID))
+            `, html.EscapeString(img), title, title, extra, genre, book.PublishedYear, book.Quantity, book.ID)
+}
+
+// @Summary Search books
+// @Description Full-text search over title, author, genre and description, best matches first. Every word must match; "quoted phrases" match as a whole and a trailing * matches a prefix (dun*). Each result has an HTML snippet with the matched words in <mark>. Without format=json the response is an HTML fragment for htmx, and an empty q falls back to the regular listing.
+// @Tags books
+// @Produce  json
+// @Param   q      query  string  true   "Search query"
+// @Param   limit  query  int     false  "Maximum results (default 20, max 50)"
+// @Success 200 {array} services.BookSearchResult
+// @Failure 400 {object} map[string]string
+// @Router /books/search [get]
+func (B *BookHandler) SearchBooks(c *fiber.Ctx) error {
+	q := c.Query("q")
+	asJSON := c.Query("format") == "json"
+	if strings.TrimSpace(q) == "" && !asJSON {
+		// the search box was cleared, show the catalog again
+		return B.GetAllBooks(c)
+	}
+
+	results, err := B.Service.SearchBooks(q, c.QueryInt("limit"))
+	if err != nil {
+		if errors.Is(err, services.ErrSearchQueryEmpty) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search books",
+		})
 	}
 
-	sb.WriteString(`</div>`) // close row
+	if asJSON {
+		return c.Status(fiber.StatusOK).JSON(results)
+	}
 
-	// Return HTML fragment (suitable for htmx hx-get)
+	var sb strings.Builder
+	sb.WriteString(`<div class="row g-3">`)
+	if len(results) == 0 {
+		sb.WriteString(`<div class="col-12"><div class="alert alert-warning mb-0">No books match your search.</div></div>`)
+	}
+	for i := range results {
+		sb.WriteString(bookCard(&results[i].Book, results[i].Snippet))
+	}
+	sb.WriteString(`</div>`)
 	return c.Status(fiber.StatusOK).Type("html").SendString(sb.String())
 }
 
@@ -155,6 +277,11 @@ func (B *BookHandler) GetBookByID(c *fiber.Ctx) error {
 	}
 	book, err := B.Service.GetBookByID(id)
 	if err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve book",
 		})
@@ -164,13 +291,170 @@ func (B *BookHandler) GetBookByID(c *fiber.Ctx) error {
 	})
 }
 
+// @Summary Update a book
+// @Description Change some or all fields of a book; fields left out keep their value. Publishers can only change their own books and only admins can change publisher_id.
+// @Tags books
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                   true  "Book ID"
+// @Param   book  body  services.BookUpdate  true  "Fields to change"
+// @Success 200 {object} models.Book
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /books/{id} [patch]
+// @Router /books/{id} [put]
+func (B *BookHandler) UpdateBook(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	var update services.BookUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+	if ok, err := B.checkOwner(c, id); !ok {
+		return err
+	}
+	if update.PublisherID != nil && middleware.CurrentRole(c) != models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only admins can change a book's publisher",
+		})
+	}
+	book, err := B.Service.UpdateBook(id, &update)
+	if err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		if errors.Is(err, services.ErrBookTitleEmpty) || errors.Is(err, services.ErrBookQuantityNegative) ||
+			errors.Is(err, repo.ErrPublisherNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update book",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book updated successfully",
+		"book":    book,
+	})
+}
+
+// @Summary Delete a book
+// @Description Remove a book from the store. The book is soft-deleted, so its loan history stays and an admin can restore it. Publishers can only remove their own books. Books with copies on loan or active holds cannot be removed.
+// @Tags books
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /books/{id} [delete]
+func (B *BookHandler) DeleteBook(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	if ok, err := B.checkOwner(c, id); !ok {
+		return err
+	}
+	if err := B.Service.DeleteBook(id); err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		if errors.Is(err, repo.ErrBookInUse) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Book has open loans or holds and cannot be deleted",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete book",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book deleted successfully",
+	})
+}
+
+// @Summary Restore a deleted book
+// @Description Undo the deletion of a book (admins only)
+// @Tags books
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /books/{id}/restore [post]
+func (B *BookHandler) RestoreBook(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	if err := B.Service.RestoreBook(id); err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		if errors.Is(err, repo.ErrBookNotDeleted) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Book is not deleted",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restore book",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Book restored successfully",
+	})
+}
+
+// checkOwner reports whether the caller may change the book: its publisher
+// or an admin. Otherwise it has already answered 404 or 403 and returns the
+// error of sending that response.
+func (B *BookHandler) checkOwner(c *fiber.Ctx, id int) (bool, error) {
+	book, err := B.Service.GetBookByID(id)
+	if err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve book",
+		})
+	}
+	if !middleware.CanActFor(c, book.PublisherID) {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only change your own books",
+		})
+	}
+	return true, nil
+}
+
 // @Summary Checkin a book
-// @Description Increase the quantity of a book by 1
+// @Description Return a copy of the book, closing the caller's open loan
 // @Tags books
 // @Produce  json
 // @Param   id  path  int  true  "Book ID"
 // @Success 200 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /books/{id}/checkin [post]
 func (B *BookHandler) Checkin(c *fiber.Ctx) error {
 	id, err := utils.ParseID(c)
@@ -179,7 +463,23 @@ func (B *BookHandler) Checkin(c *fiber.Ctx) error {
 			"error": "Invalid Book",
 		})
 	}
-	if err := B.Service.Checkin(id); err != nil {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if err := B.Service.Checkin(id, userID); err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		if errors.Is(err, repo.ErrNoActiveLoan) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "You have no open loan for this book",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to checkin book",
 		})
@@ -190,12 +490,14 @@ func (B *BookHandler) Checkin(c *fiber.Ctx) error {
 }
 
 // @Summary Checkout a book
-// @Description Decrease the quantity of a book by 1
+// @Description Take a copy of the book, opening a loan for the caller
 // @Tags books
 // @Produce  json
 // @Param   id  path  int  true  "Book ID"
 // @Success 200 {object} map[string]string
+// @Failure 402 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /books/{id}/checkout [post]
 func (B *BookHandler) Checkout(c *fiber.Ctx) error {
 	id, err := utils.ParseID(c)
@@ -204,7 +506,28 @@ func (B *BookHandler) Checkout(c *fiber.Ctx) error {
 			"error": "Invalid Book",
 		})
 	}
-	if err := B.Service.Checkout(id); err != nil {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if err := B.Service.Checkout(id, userID); err != nil {
+		if errors.Is(err, repo.ErrBookNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Book not found",
+			})
+		}
+		if errors.Is(err, services.ErrBalanceOverLimit) {
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"error": "Outstanding balance too high to check out",
+			})
+		}
+		if errors.Is(err, repo.ErrBookUnavailable) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Book not available for checkout",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to checkout book",
 		})
@@ -236,10 +559,21 @@ func (B *BookHandler) GetBookDetails(c *fiber.Ctx) error {
 	// checkin/checkout logic (for button label)
 	actionLabel := "Check Out"
 
-	html := fmt.Sprintf(`
+	// every field comes from the publisher, escape them all
+	title := html.EscapeString(book.Title)
+	about := ""
+	if book.Author != "" {
+		about += fmt.Sprintf(`<p class="text-muted">By %s</p>`, html.EscapeString(book.Author))
+	}
+	if book.Description != "" {
+		about += fmt.Sprintf(`<p>%s</p>`, html.EscapeString(book.Description))
+	}
+
+	fragment := fmt.Sprintf(`
         <div class="d-flex flex-column align-items-center">
             <img src="%s" alt="%s cover" class="img-fluid mb-3" style="max-height:400px; object-fit:cover;">
             <h3>%s</h3>
+            %s
             <p class="text-muted">Genre: %s</p>
             <p>Published: %d</p>
             <p>Quantity: %d</p>
@@ -250,7 +584,7 @@ func (B *BookHandler) GetBookDetails(c *fiber.Ctx) error {
                 %s
             </button>
         </div>
-    `, img, book.Title, book.Title, book.Genre, book.PublishedYear, book.Quantity, book.ID, actionLabel)
+    `, html.EscapeString(img), title, title, about, html.EscapeString(book.Genre), book.PublishedYear, book.Quantity, book.ID, actionLabel)
 
-	return c.Type("html").SendString(html)
+	return c.Type("html").SendString(fragment)
 }
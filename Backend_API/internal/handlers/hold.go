@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	utils "first_task/go-fiber-api/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HoldHandler struct {
+	Service *services.HoldService
+}
+
+func NewHoldHandler(s *services.HoldService) *HoldHandler {
+	return &HoldHandler{Service: s}
+}
+
+// CreateHold godoc
+// @Summary Place a hold on a book
+// @Description Join the FIFO waitlist of an out-of-stock book
+// @Tags holds
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 201 {object} models.Hold
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /books/{id}/holds [post]
+func (h *HoldHandler) CreateHold(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	hold, err := h.Service.CreateHold(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrBookNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Book not found"})
+		case errors.Is(err, repo.ErrBookAvailable), errors.Is(err, repo.ErrHoldExists):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to place hold",
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Hold placed successfully",
+		"hold":    hold,
+	})
+}
+
+// GetBookHolds godoc
+// @Summary List holds for a book
+// @Description Retrieve the holds of a book with their users, in queue order (staff only)
+// @Tags holds
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200 {array} models.Hold
+// @Failure 403 {object} map[string]string
+// @Router /books/{id}/holds [get]
+func (h *HoldHandler) GetBookHolds(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	holds, err := h.Service.GetHoldsByBook(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve holds",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"holds": holds,
+	})
+}
+
+// GetUserHolds godoc
+// @Summary List holds for a user
+// @Description Retrieve the holds placed by a user, newest first (the user or an admin)
+// @Tags holds
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {array} models.Hold
+// @Failure 403 {object} map[string]string
+// @Router /users/{id}/holds [get]
+func (h *HoldHandler) GetUserHolds(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if !middleware.CanActFor(c, id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only view your own holds",
+		})
+	}
+	holds, err := h.Service.GetHoldsByUser(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve holds",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"holds": holds,
+	})
+}
+
+// CancelHold godoc
+// @Summary Cancel a hold
+// @Description Leave the waitlist; a copy reserved for the hold passes to the next user
+// @Tags holds
+// @Produce  json
+// @Param   id  path  int  true  "Hold ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /holds/{id} [delete]
+func (h *HoldHandler) CancelHold(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Hold",
+		})
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if err := h.Service.CancelHold(id, userID); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrHoldNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Hold not found"})
+		case errors.Is(err, repo.ErrNotHolder):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only cancel your own holds"})
+		case errors.Is(err, repo.ErrHoldClosed):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel hold",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Hold cancelled successfully",
+	})
+}
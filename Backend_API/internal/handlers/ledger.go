@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	"first_task/go-fiber-api/internal/models"
+	"first_task/go-fiber-api/internal/services"
+	utils "first_task/go-fiber-api/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LedgerHandler struct {
+	Service     *services.LedgerService
+	UserService *services.UserService
+}
+
+func NewLedgerHandler(s *services.LedgerService, us *services.UserService) *LedgerHandler {
+	return &LedgerHandler{Service: s, UserService: us}
+}
+
+type PaymentRequest struct {
+	AmountCents int    `json:"amount_cents"`
+	Kind        string `json:"kind"` // "payment" (default) or "waiver"
+	Note        string `json:"note"`
+}
+
+// GetBalance godoc
+// @Summary Get a user's balance
+// @Description Retrieve what a user owes in cents together with their ledger of charges, payments and waivers (the user or an admin)
+// @Tags ledger
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/balance [get]
+func (h *LedgerHandler) GetBalance(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if !middleware.CanActFor(c, id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only view your own balance",
+		})
+	}
+	if _, err := h.UserService.GetUserByID(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	balance, entries, err := h.Service.GetBalance(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve balance",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"user_id":       id,
+		"balance_cents": balance,
+		"entries":       entries,
+	})
+}
+
+// RecordPayment godoc
+// @Summary Record a payment or waiver
+// @Description Credit a user's account with a payment or a waiver (admins only)
+// @Tags ledger
+// @Accept  json
+// @Produce  json
+// @Param   id       path  int             true  "User ID"
+// @Param   payment  body  PaymentRequest  true  "Payment Data"
+// @Success 201 {object} models.LedgerEntry
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/payments [post]
+func (h *LedgerHandler) RecordPayment(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	var req PaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+	if req.Kind == "" {
+		req.Kind = models.LedgerPayment
+	}
+	staffID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	if _, err := h.UserService.GetUserByID(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	entry, err := h.Service.RecordPayment(id, req.Kind, req.AmountCents, req.Note, staffID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPayment) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record payment",
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Payment recorded successfully",
+		"entry":   entry,
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	utils "first_task/go-fiber-api/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LoanHandler struct {
+	Service *services.LoanService
+}
+
+func NewLoanHandler(s *services.LoanService) *LoanHandler {
+	return &LoanHandler{Service: s}
+}
+
+// GetBookLoans godoc
+// @Summary List loans for a book
+// @Description Retrieve active and past loans of a book with their borrowers, newest first (staff only)
+// @Tags loans
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200 {array} models.Loan
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /books/{id}/loans [get]
+func (h *LoanHandler) GetBookLoans(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Book",
+		})
+	}
+	loans, err := h.Service.GetLoansByBook(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve loans",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"loans": loans,
+	})
+}
+
+// GetUserLoans godoc
+// @Summary List loans for a user
+// @Description Retrieve active and past loans of a borrower, newest first (the borrower or an admin)
+// @Tags loans
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {array} models.Loan
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users/{id}/loans [get]
+func (h *LoanHandler) GetUserLoans(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if !middleware.CanActFor(c, id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only view your own loans",
+		})
+	}
+	loans, err := h.Service.GetLoansByUser(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve loans",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"loans": loans,
+	})
+}
+
+// GetOverdueLoans godoc
+// @Summary List overdue loans
+// @Description Retrieve open loans that are past their due date (staff only)
+// @Tags loans
+// @Produce  json
+// @Success 200 {array} models.Loan
+// @Router /loans/overdue [get]
+func (h *LoanHandler) GetOverdueLoans(c *fiber.Ctx) error {
+	loans, err := h.Service.GetOverdueLoans()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve loans",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"loans": loans,
+	})
+}
+
+// RenewLoan godoc
+// @Summary Renew a loan
+// @Description Extend the caller's open loan by one loan period
+// @Tags loans
+// @Produce  json
+// @Param   id  path  int  true  "Loan ID"
+// @Success 200 {object} models.Loan
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /loans/{id}/renew [post]
+func (h *LoanHandler) RenewLoan(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Loan",
+		})
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	loan, err := h.Service.RenewLoan(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrLoanNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Loan not found"})
+		case errors.Is(err, repo.ErrNotBorrower):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only renew your own loans"})
+		case errors.Is(err, repo.ErrLoanClosed),
+			errors.Is(err, repo.ErrLoanOverdue),
+			errors.Is(err, repo.ErrRenewalLimit),
+			errors.Is(err, repo.ErrHoldsWaiting):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to renew loan",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Loan renewed successfully",
+		"loan":    loan,
+	})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	utils "first_task/go-fiber-api/pkg"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type MFAHandler struct {
+	Service     *services.MFAService
+	UserService *services.UserService
+	Guard       *services.LoginGuard
+}
+
+func NewMFAHandler(s *services.MFAService, us *services.UserService, guard *services.LoginGuard) *MFAHandler {
+	return &MFAHandler{Service: s, UserService: us, Guard: guard}
+}
+
+type EnrollMFARequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // only when replacing an enabled authenticator
+}
+
+type ConfirmMFARequest struct {
+	Code string `json:"code"`
+}
+
+// EnrollMFA godoc
+// @Summary Start two-factor enrollment
+// @Description Create a TOTP secret for the caller and return its otpauth URI with single-use recovery codes. Requires the current password, and a current code to replace an enabled authenticator. Two-factor login stays off until the enrollment is confirmed. API keys and impersonation tokens are refused.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body  EnrollMFARequest  true  "Current password"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /users/me/2fa [post]
+func (h *MFAHandler) EnrollMFA(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	var req EnrollMFARequest
+	if err := c.BodyParser(&req); err != nil || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "current password is required",
+		})
+	}
+	user, err := h.UserService.GetUserByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	// wrong passwords and codes count towards the login lockout, so a stolen
+	// token cannot be used to guess them
+	ip := c.IP()
+	if err := h.Guard.Check(ip, user); err != nil {
+		return loginLocked(c, err)
+	}
+	uri, codes, err := h.Service.Enroll(userID, req.Password, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrWrongPassword) {
+			h.Guard.RecordFailure(ip, user)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			h.Guard.RecordFailure(ip, user)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrMFAAlreadyOn) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "two-factor authentication already enabled, send a current code to replace it",
+			})
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not start two-factor enrollment",
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"otpauth_uri":    uri,
+		"recovery_codes": codes, // shown once, only their hashes are kept
+		"message":        "add the key to your authenticator app, then confirm with a code",
+	})
+}
+
+// ConfirmMFA godoc
+// @Summary Confirm two-factor enrollment
+// @Description Turn on two-factor login after checking a code from the newly enrolled authenticator
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body  ConfirmMFARequest  true  "TOTP Code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/me/2fa/confirm [post]
+func (h *MFAHandler) ConfirmMFA(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	var req ConfirmMFARequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	err = h.Service.Confirm(userID, req.Code)
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{
+			"message": "two-factor authentication enabled",
+		})
+	case errors.Is(err, services.ErrInvalidMFACode), errors.Is(err, services.ErrMFANotEnrolled):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrMFAAlreadyOn):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not enable two-factor authentication",
+		})
+	}
+}
+
+// ResetUserMFA godoc
+// @Summary Reset a user's two-factor authentication
+// @Description Turn off two-factor login and drop the authenticator and recovery codes of a user who lost them, so they can log in with their password and enroll again (admins only)
+// @Tags admin
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/2fa/reset [post]
+func (h *MFAHandler) ResetUserMFA(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if err := h.Service.Reset(id); err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not reset two-factor authentication",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "two-factor authentication reset",
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OIDCHandler serves the OpenID Connect provider endpoints and the admin
+// endpoints that register its clients. LoginURL is the web front-end's login
+// page; signed-out users are sent there with a return_to parameter.
+type OIDCHandler struct {
+	Service  *services.OIDCService
+	LoginURL string
+}
+
+func NewOIDCHandler(s *services.OIDCService, loginURL string) *OIDCHandler {
+	return &OIDCHandler{Service: s, LoginURL: loginURL}
+}
+
+type RegisterClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"` // server-side apps that can keep a secret
+}
+
+// Discovery godoc
+// @Summary OpenID Connect discovery document
+// @Description Describes the provider's endpoints and capabilities (OpenID Connect Discovery 1.0)
+// @Tags oidc
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/openid-configuration [get]
+func (h *OIDCHandler) Discovery(c *fiber.Ctx) error {
+	issuer := h.Service.Issuer
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/api/oauth/authorize",
+		"token_endpoint":                        issuer + "/api/oauth/token",
+		"userinfo_endpoint":                     issuer + "/api/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"scopes_supported":                      append(models.IdentityScopes(), models.RoleScopes(models.RoleAdmin)...),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{h.Service.Tokens.SigningAlg()},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "given_name", "family_name", "picture"},
+	})
+}
+
+// RequireLogin checks the client and redirect URI of an authorization
+// request, then sends users without a session to the login page. Errors in
+// the client or redirect URI are shown here and never redirected, so the
+// endpoint cannot be used as an open redirect.
+func (h *OIDCHandler) RequireLogin(c *fiber.Ctx) error {
+	var req services.AuthorizeRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid authorization request",
+		})
+	}
+	if _, err := h.Service.CheckClient(req.ClientID, req.RedirectURI); err != nil {
+		if errors.Is(err, repo.ErrOAuthClientNotFound) || errors.Is(err, services.ErrRedirectURIMismatch) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not check client",
+		})
+	}
+	if c.Get(fiber.HeaderAuthorization) == "" && c.Cookies(middleware.SessionCookie) == "" {
+		if h.LoginURL == "" {
+			return redirectWith(c, req.RedirectURI, req.State, "error", "login_required")
+		}
+		return c.Redirect(h.LoginURL+"?return_to="+url.QueryEscape(h.Service.Issuer+c.OriginalURL()), fiber.StatusFound)
+	}
+	return c.Next()
+}
+
+// Authorize godoc
+// @Summary OpenID Connect authorization endpoint
+// @Description Authorization code flow with PKCE for the signed-in user. Redirects to the client's redirect_uri with a code, or with an error. Requires the session cookie or a Bearer token; signed-out users are sent to the login page first.
+// @Tags oidc
+// @Param   response_type          query  string  true   "code"
+// @Param   client_id              query  string  true   "Client ID"
+// @Param   redirect_uri           query  string  true   "A registered redirect URI"
+// @Param   scope                  query  string  true   "Space separated, must include openid"
+// @Param   state                  query  string  false  "Returned unchanged"
+// @Param   nonce                  query  string  false  "Copied into the ID token"
+// @Param   code_challenge         query  string  true   "PKCE challenge"
+// @Param   code_challenge_method  query  string  true   "S256"
+// @Success 302
+// @Failure 400 {object} map[string]string
+// @Router /oauth/authorize [get]
+func (h *OIDCHandler) Authorize(c *fiber.Ctx) error {
+	var req services.AuthorizeRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid authorization request",
+		})
+	}
+	current, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		return redirectWith(c, req.RedirectURI, req.State, "error", "login_required")
+	}
+	// only the user themselves may sign in to another app
+	if current.APIKeyID != 0 || current.ActorID != 0 {
+		return redirectWith(c, req.RedirectURI, req.State, "error", "access_denied",
+			"error_description", "sign in with your password to authorize apps")
+	}
+	user, err := h.Service.Users.GetUserByID(current.ID)
+	if err != nil {
+		return redirectWith(c, req.RedirectURI, req.State, "error", "login_required")
+	}
+
+	code, err := h.Service.Authorize(user, current.IssuedAt, &req)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			return redirectWith(c, req.RedirectURI, req.State, "error", oauthErr.Code,
+				"error_description", oauthErr.Description)
+		}
+		return redirectWith(c, req.RedirectURI, req.State, "error", "server_error")
+	}
+	return redirectWith(c, req.RedirectURI, req.State, "code", code)
+}
+
+// Token godoc
+// @Summary OpenID Connect token endpoint
+// @Description Exchange an authorization code and its PKCE code_verifier for an access token and an ID token. Confidential clients authenticate with HTTP Basic or client_secret in the body, public clients send only client_id.
+// @Tags oidc
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param   body  body  services.TokenRequest  true  "Token request"
+// @Success 200 {object} services.TokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /oauth/token [post]
+func (h *OIDCHandler) Token(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	var req services.TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "send the parameters as application/x-www-form-urlencoded",
+		})
+	}
+	basic := false
+	if raw, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic "); ok {
+		id, secret, ok := parseBasicCredentials(raw)
+		if !ok {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":             "invalid_client",
+				"error_description": "malformed basic credentials",
+			})
+		}
+		basic = true
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	tokens, err := h.Service.Exchange(&req)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "server_error",
+			})
+		}
+		status := fiber.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = fiber.StatusUnauthorized
+			if basic {
+				c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+			}
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":             oauthErr.Code,
+			"error_description": oauthErr.Description,
+		})
+	}
+	return c.JSON(tokens)
+}
+
+// UserInfo godoc
+// @Summary OpenID Connect userinfo endpoint
+// @Description Claims about the user an access token with the openid scope was issued to: email and email_verified with the email scope, names and picture with the profile scope
+// @Tags oidc
+// @Produce  json
+// @Success 200 {object} services.IDTokenClaims
+// @Failure 403 {object} map[string]string
+// @Router /oauth/userinfo [get]
+func (h *OIDCHandler) UserInfo(c *fiber.Ctx) error {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	claims, err := h.Service.UserInfo(user.ID, user.Scopes)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	return c.JSON(claims)
+}
+
+// RegisterClient godoc
+// @Summary Register an OpenID Connect client
+// @Description Register an internal app that signs users in with their bookstore account (admins only). Confidential clients get a client_secret, shown only in this response.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   body  body  RegisterClientRequest  true  "Client"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /admin/oauth/clients [post]
+func (h *OIDCHandler) RegisterClient(c *fiber.Ctx) error {
+	var req RegisterClientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+	client, secret, err := h.Service.RegisterClient(req.Name, req.RedirectURIs, req.Confidential)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthClientNameEmpty) || errors.Is(err, services.ErrInvalidRedirectURI) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not register client",
+		})
+	}
+	response := fiber.Map{"client": client}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ListClients godoc
+// @Summary List OpenID Connect clients
+// @Description Retrieve every registered client (admins only)
+// @Tags admin
+// @Produce  json
+// @Success 200 {array} models.OAuthClient
+// @Router /admin/oauth/clients [get]
+func (h *OIDCHandler) ListClients(c *fiber.Ctx) error {
+	clients, err := h.Service.GetClients()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve clients",
+		})
+	}
+	return c.JSON(clients)
+}
+
+// DeleteClient godoc
+// @Summary Delete an OpenID Connect client
+// @Description Remove a client and its pending authorization codes (admins only). Tokens it already obtained stay valid until they expire.
+// @Tags admin
+// @Produce  json
+// @Param   clientId  path  string  true  "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/oauth/clients/{clientId} [delete]
+func (h *OIDCHandler) DeleteClient(c *fiber.Ctx) error {
+	if err := h.Service.DeleteClient(c.Params("clientId")); err != nil {
+		if errors.Is(err, repo.ErrOAuthClientNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not delete client",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "client deleted",
+	})
+}
+
+// redirectWith redirects to a client's redirect URI with the given query
+// parameters (name, value pairs) and the request's state added.
+func redirectWith(c *fiber.Ctx, redirectURI, state string, params ...string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": services.ErrRedirectURIMismatch.Error(),
+		})
+	}
+	q := u.Query()
+	for i := 0; i+1 < len(params); i += 2 {
+		q.Set(params[i], params[i+1])
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Redirect(u.String(), fiber.StatusFound)
+}
+
+// parseBasicCredentials decodes HTTP Basic client credentials, which RFC 6749
+// form-encodes before joining them.
+func parseBasicCredentials(raw string) (string, string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+	id, err1 := url.QueryUnescape(id)
+	secret, err2 := url.QueryUnescape(secret)
+	if err1 != nil || err2 != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasswordHandler struct {
+	Service *services.PasswordService
+}
+
+func NewPasswordHandler(s *services.PasswordService) *PasswordHandler {
+	return &PasswordHandler{Service: s}
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use, expiring reset token. The response is the same whether or not the email belongs to an account.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body  ForgotPasswordRequest  true  "Account Email"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /password/forgot [post]
+func (h *PasswordHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if err := h.Service.RequestReset(req.Email); err != nil {
+		// keep the answer identical for every email, the failure is only logged
+		log.Printf("password reset request failed: %v", err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if an account exists for this email, a reset token has been sent",
+	})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password using a reset token. All existing sessions of the account are revoked.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body  ResetPasswordRequest  true  "Reset Token and New Password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /password/reset [post]
+func (h *PasswordHandler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if err := h.Service.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrWeakPassword) || errors.Is(err, repo.ErrUserTokenInvalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not reset password",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "password updated, please log in again",
+	})
+}
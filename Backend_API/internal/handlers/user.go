@@ -1,31 +1,50 @@
 package handlers
 
 import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
 	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
 	"first_task/go-fiber-api/internal/services"
 	utils "first_task/go-fiber-api/pkg"
 	"fmt"
 	"html"
+	"log"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	Service *services.UserService
+	Service      *services.UserService
+	TokenSvc     *services.TokenService
+	Verification *services.VerificationService
 }
 
-func NewUserHandler(s *services.UserService) *UserHandler {
-	return &UserHandler{Service: s}
+func NewUserHandler(s *services.UserService, ts *services.TokenService, vs *services.VerificationService) *UserHandler {
+	return &UserHandler{Service: s, TokenSvc: ts, Verification: vs}
 }
 
 type CreateUserRequest struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
+	Role      string `json:"role"` // defaults to member
 }
 
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create a user with any role (admins only)
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   user  body  CreateUserRequest  true  "User Data"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users [post]
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	var req CreateUserRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -34,13 +53,38 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if strings.TrimSpace(req.Email) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is required",
+		})
+	}
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+	if !models.ValidRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be admin, publisher or member",
+		})
+	}
+
 	user := models.User{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		Email:     req.Email,
+		Role:      req.Role,
 	}
 
 	if err := h.Service.CreateUser(&user); err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, repo.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "email already registered",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
@@ -54,13 +98,14 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 
 // GetAllUsers godoc
 // @Summary Get all users
-// @Description Retrieve all users from the system
+// @Description Retrieve all users from the system, with ?include_deleted=true also deleted ones
 // @Tags users
 // @Produce  json
+// @Param   include_deleted  query  bool  false  "Include deleted users"
 // @Success 200 {array} models.User
 // @Router /users [get]
 func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
-	users, err := h.Service.GetAllUsers()
+	users, err := h.Service.GetAllUsers(c.QueryBool("include_deleted"))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve users",
@@ -89,6 +134,11 @@ func (h *UserHandler) GetUserByID(c *fiber.Ctx) error {
 	}
 	user, err := h.Service.GetUserByID(id)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve user",
 		})
@@ -98,44 +148,161 @@ func (h *UserHandler) GetUserByID(c *fiber.Ctx) error {
 	})
 }
 
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Soft-delete a user, end their sessions and revoke their API keys (admins only). Their books, loans and payments are kept and the account can be restored. The email is freed for new accounts.
+// @Tags users
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if callerID, _ := middleware.CurrentUserID(c); callerID == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot delete your own account",
+		})
+	}
+	if err := h.Service.DeleteUser(id); err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete user",
+		})
+	}
+	// tokens issued before the deletion must stop working now, not when they expire
+	if err := h.TokenSvc.RevokeUserSessions(id); err != nil {
+		log.Printf("could not revoke sessions of deleted user %d: %v", id, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User deleted successfully",
+	})
+}
+
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undo the deletion of a user (admins only). They log in again with their old password. Fails with 409 when their email was registered again in the meantime.
+// @Tags users
+// @Produce  json
+// @Param   id  path  int  true  "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if err := h.Service.RestoreUser(id); err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		if errors.Is(err, repo.ErrUserNotDeleted) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "User is not deleted",
+			})
+		}
+		if errors.Is(err, repo.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "email has been registered by another user since the deletion",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restore user",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User restored successfully",
+	})
+}
+
 // UpdateUser godoc
 // @Summary Update a user
-// @Description Update an existing user's information
+// @Description Update an existing user's name and email; the email is required. Users may only update themselves unless they are an admin.
 // @Tags users
 // @Accept  json
 // @Produce  json
+// @Param   id    path  int          true  "User ID"
 // @Param   user  body  models.User  true  "User Data"
 // @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /users [put]
+// @Failure 409 {object} map[string]string
+// @Router /users/{id} [put]
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
+	id, err := utils.ParseID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User",
+		})
+	}
+	if !middleware.CanActFor(c, id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only update your own account",
+		})
+	}
 	var user models.User
 	if err := c.BodyParser(&user); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Failed to parse request body",
 		})
 	}
+	// the path decides which user is updated, never the body
+	user.ID = id
 	if err := h.Service.UpdateUser(&user); err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, repo.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		if errors.Is(err, repo.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "email already registered",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
+			"error": "Failed to update user",
+		})
+	}
+	updated, err := h.Service.GetUserByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve user",
 		})
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User updated successfully",
-		"user":    user,
+		"user":    updated,
 	})
 }
 
 func (h *UserHandler) Protected(c *fiber.Ctx) error {
-	userToken := c.Locals("user")
-	if userToken == nil {
+	user, err := middleware.GetCurrentUser(c) // from jwt middleware
+	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).SendString("missing token")
 	}
-	token := userToken.(*jwt.Token) // from jwt middleware
-	claims := token.Claims.(jwt.MapClaims)
-	sub := claims["sub"]
-	name, _ := claims["name"].(string)
-	return c.SendString(fmt.Sprintf("hello user %v (name: %s)", sub, name))
+	return c.SendString(fmt.Sprintf("hello user %d (role: %s)", user.ID, user.Role))
 }
 
 type SignupRequest struct {
@@ -147,13 +314,14 @@ type SignupRequest struct {
 
 // Signup godoc
 // @Summary Register a new user
-// @Description Create a new user account, hash the password, and return access and refresh tokens
+// @Description Create a new, unverified user account, hash the password, email a verification link, and return access and refresh tokens
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param   user  body  SignupRequest  true  "User Signup Data"
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /signup [post]
 func (h *UserHandler) Signup(c *fiber.Ctx) error {
@@ -162,6 +330,13 @@ func (h *UserHandler) Signup(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 	}
 
+	if strings.TrimSpace(req.Email) == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email and password are required"})
+	}
+	if len(req.Password) < services.MinPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": services.ErrWeakPassword.Error()})
+	}
+
 	// hash password
 	hashed, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -173,23 +348,40 @@ func (h *UserHandler) Signup(c *fiber.Ctx) error {
 		LastName:  req.LastName,
 		Email:     req.Email,
 		Password:  hashed,
+		Role:      models.RoleMember, // elevated roles are granted by an admin
 	}
 
 	if err := h.Service.CreateUser(&user); err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, repo.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "email already registered"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create user"})
 	}
 
+	// the account starts unverified until the emailed link is opened
+	if err := h.Verification.SendVerification(&user); err != nil {
+		log.Printf("could not send verification email to user %d: %v", user.ID, err)
+	}
+
 	// generate tokens
-	accessToken, refreshToken, err := utils.GenerateTokens(user.ID, user.Email)
+	accessToken, err := h.TokenSvc.CreateAccessToken(&user, nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate tokens"})
+	}
+	refreshToken, err := h.TokenSvc.CreateRefreshToken(user.ID, "", nil)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate tokens"})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"user ID":       user.ID,
-		"message":       "user created successfully",
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"user ID":        user.ID,
+		"message":        "user created successfully, check your email to verify your address",
+		"email_verified": false,
+		"access_token":   accessToken,
+		"refresh_token":  refreshToken,
 	})
 }
 func (h *UserHandler) GetAllPublishersWithoutBooks(c *fiber.Ctx) error {
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/middleware"
+	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type VerificationHandler struct {
+	Service *services.VerificationService
+}
+
+func NewVerificationHandler(s *services.VerificationService) *VerificationHandler {
+	return &VerificationHandler{Service: s}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm the email address of the account a verification link was sent to
+// @Tags auth
+// @Produce  json
+// @Param   token  query  string  true  "Verification Token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /verify-email [get]
+func (h *VerificationHandler) VerifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "missing token",
+		})
+	}
+	if err := h.Service.Verify(token); err != nil {
+		if errors.Is(err, repo.ErrUserTokenInvalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "could not verify email",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "email address verified",
+	})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Send a new verification link to the caller, at most once per cooldown period
+// @Tags auth
+// @Produce  json
+// @Success 202 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /verify-email/resend [post]
+func (h *VerificationHandler) ResendVerification(c *fiber.Ctx) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid or missing token",
+		})
+	}
+	err = h.Service.Resend(userID)
+	var tooSoon *services.ResendTooSoonError
+	switch {
+	case err == nil:
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "verification email sent",
+		})
+	case errors.As(err, &tooSoon):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(tooSoon.RetryAfter.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrAlreadyVerified):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "could not send verification email",
+	})
+}
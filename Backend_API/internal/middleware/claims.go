@@ -0,0 +1,97 @@
+// internal/middleware/claims.go
+package middleware
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"first_task/go-fiber-api/internal/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrMissingClaims = errors.New("missing or invalid token claims")
+
+// currentUserKey is the c.Locals key NewJWT stores the caller under.
+const currentUserKey = "currentUser"
+
+// CurrentUser is the authenticated caller of a request, taken from the claims
+// of their access token.
+type CurrentUser struct {
+	ID        int
+	Role      string
+	TokenID   string // the token's "jti", empty for API keys
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Scopes    []string // granted by the token or API key
+	APIKeyID  int      // set when the caller authenticated with an API key
+	ActorID   int      // the admin impersonating this user, if any
+}
+
+// setCurrentUser stores the caller of an access token with their current
+// role, which may differ from the role the token was issued with.
+func setCurrentUser(c *fiber.Ctx, claims *services.Claims, role string) *CurrentUser {
+	id, _ := claims.UserID()
+	user := &CurrentUser{ID: id, Role: role, TokenID: claims.ID, Scopes: claims.Scopes(), ActorID: claims.ActorID()}
+	if claims.IssuedAt != nil {
+		user.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		user.ExpiresAt = claims.ExpiresAt.Time
+	}
+	c.Locals(currentUserKey, user)
+	return user
+}
+
+func setAPIKeyUser(c *fiber.Ctx, key *models.APIKey, user *models.User) {
+	c.Locals(currentUserKey, &CurrentUser{
+		ID:       user.ID,
+		Role:     user.Role,
+		APIKeyID: key.ID,
+		Scopes:   key.ScopeList(),
+	})
+}
+
+// GetCurrentUser returns the caller stored by NewJWT, or ErrMissingClaims on
+// routes without it.
+func GetCurrentUser(c *fiber.Ctx) (*CurrentUser, error) {
+	user, ok := c.Locals(currentUserKey).(*CurrentUser)
+	if !ok {
+		return nil, ErrMissingClaims
+	}
+	return user, nil
+}
+
+// CurrentRole returns the caller's role, or "" when there is none.
+func CurrentRole(c *fiber.Ctx) string {
+	user, err := GetCurrentUser(c)
+	if err != nil {
+		return ""
+	}
+	return user.Role
+}
+
+// CurrentTokenID returns the "jti" and expiry of the caller's access token.
+func CurrentTokenID(c *fiber.Ctx) (string, time.Time) {
+	user, err := GetCurrentUser(c)
+	if err != nil {
+		return "", time.Time{}
+	}
+	return user.TokenID, user.ExpiresAt
+}
+
+// CurrentUserID returns the caller's user ID.
+func CurrentUserID(c *fiber.Ctx) (int, error) {
+	user, err := GetCurrentUser(c)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// CanActFor reports whether the caller may change userID's data: users may
+// act on themselves, admins on anyone.
+func CanActFor(c *fiber.Ctx, userID int) bool {
+	user, err := GetCurrentUser(c)
+	return err == nil && (user.Role == models.RoleAdmin || user.ID == userID)
+}
@@ -2,26 +2,86 @@
 package middleware
 
 import (
+	"errors"
+	"first_task/go-fiber-api/internal/services"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
-	jwtware "github.com/gofiber/contrib/jwt"
+	"gorm.io/gorm"
 )
 
-// NewJWT returns a Fiber middleware configured for HS256
-//fiber.Handler function b red a middleware function ta aamallu attach to routes.
-func NewJWT(secret string) fiber.Handler { //jwtware.New is the function that creates the middleware
-	return jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(secret)}, //middleware byestaamel this to verify incoming access tokens.
-		SuccessHandler: func(c *fiber.Ctx) error {
-			// Optionally do extra validation (aud/iss) after signature valid
-			// the middleware already sets c.Locals("user") 
-			return c.Next() //continue to the requested route
-		},
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			// Return JSON error instead of default
+// NewJWT returns a Fiber middleware that authenticates the caller and stores
+// them as a *CurrentUser in c.Locals. It accepts a JWT access token
+// ("Authorization: Bearer ..." or the session cookie) checked by the token
+// service, or a personal API key ("Authorization: ApiKey ...") checked by the
+// API key service. Cookie-authenticated unsafe requests need a CSRF token.
+// Requests made with an impersonation token are read-only and audited.
+// fiber.Handler function b red a middleware function ta aamallu attach to routes.
+// Tokens that were revoked (logout, session revocation) are rejected.
+// The caller's role is read from the user, not the token's "role" claim, so
+// a demoted user loses their old rights at once.
+func NewJWT(tokens *services.TokenService, apiKeys *services.APIKeyService, users *services.UserService, audit *services.AuditService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		if raw, ok := strings.CutPrefix(header, "ApiKey "); ok {
+			key, user, err := apiKeys.Authenticate(strings.TrimSpace(raw))
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidAPIKey) {
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+						"error": err.Error(),
+					})
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "could not verify api key",
+				})
+			}
+			setAPIKeyUser(c, key, user)
+			return c.Next()
+		}
+
+		raw, ok := strings.CutPrefix(header, "Bearer ")
+		if header == "" {
+			if raw = c.Cookies(SessionCookie); raw != "" {
+				if !validCSRF(c) {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"error": "missing or invalid csrf token",
+					})
+				}
+				ok = true
+			}
+		}
+		if !ok || strings.TrimSpace(raw) == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": services.ErrInvalidAccessToken.Error(),
+			})
+		}
+		claims, err := tokens.Authenticate(strings.TrimSpace(raw))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAccessToken) || errors.Is(err, services.ErrTokenRevoked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "could not verify token",
+			})
+		}
+		userID, _ := claims.UserID()
+		account, err := users.GetUserByID(userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "invalid or missing token",
+				"error": services.ErrInvalidAccessToken.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "could not verify token",
 			})
-		},
-		
-	})
+		}
+		user := setCurrentUser(c, claims, account.Role)
+		if user.ActorID != 0 {
+			return impersonated(c, user, audit)
+		}
+		return c.Next() //continue to the requested route
+	}
 }
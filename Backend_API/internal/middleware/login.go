@@ -0,0 +1,26 @@
+// internal/middleware/login.go
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireOwnLogin refuses API keys and impersonation tokens on routes that
+// change how the account logs in, so only the user's own login may reach
+// them. It must run after the JWT middleware.
+func RequireOwnLogin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := GetCurrentUser(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or missing token",
+			})
+		}
+		if user.APIKeyID != 0 || user.ActorID != 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "log in with your password to change this",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequireOwnLogin(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller *CurrentUser
+		want   int
+	}{
+		{"own login", &CurrentUser{ID: 1, TokenID: "jti"}, fiber.StatusOK},
+		{"api key", &CurrentUser{ID: 1, APIKeyID: 7}, fiber.StatusForbidden},
+		{"impersonation", &CurrentUser{ID: 1, TokenID: "jti", ActorID: 2}, fiber.StatusForbidden},
+		{"anonymous", nil, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", func(c *fiber.Ctx) error {
+				if tt.caller != nil {
+					c.Locals(currentUserKey, tt.caller)
+				}
+				return c.Next()
+			}, RequireOwnLogin(), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// internal/middleware/role.go
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole only lets the request through when the caller's current role
+// is one of roles. It must run after the JWT middleware, which looks the role
+// up instead of trusting the token's "role" claim.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role := CurrentRole(c)
+		for _, r := range roles {
+			if role == r {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "insufficient role",
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// internal/middleware/scope.go
+package middleware
+
+import (
+	"first_task/go-fiber-api/internal/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope only lets the request through when the caller's token or API
+// key carries every one of scopes and their role still allows them.
+// It must run after the JWT middleware.
+func RequireScope(scopes ...string) fiber.Handler {
+	required := strings.Join(scopes, " ")
+	return func(c *fiber.Ctx) error {
+		user, err := GetCurrentUser(c)
+		if err == nil && hasScopes(user, scopes) {
+			return c.Next()
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+required+`"`)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "insufficient_scope",
+			"scope": required,
+		})
+	}
+}
+
+func hasScopes(user *CurrentUser, scopes []string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range user.Scopes {
+			if s == scope {
+				granted = true
+				break
+			}
+		}
+		// an API key keeps its scopes when its owner's role is lowered later
+		if !granted || !models.RoleAllowsScope(user.Role, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+// internal/middleware/session.go
+package middleware
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cookie mode: the access token lives in an HttpOnly cookie that scripts
+// cannot read, and unsafe requests must echo the CSRF cookie in a header
+// (double-submit), which a cross-site form cannot do.
+const (
+	SessionCookie = "session"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// SessionCookies holds the attributes of the session and CSRF cookies.
+type SessionCookies struct {
+	Secure   bool
+	SameSite string // "Strict", "Lax" or "None"
+	Domain   string
+}
+
+// Set stores the access token and the CSRF token in cookies until expires.
+func (s SessionCookies) Set(c *fiber.Ctx, token string, csrf string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Domain:   s.Domain,
+		Expires:  expires,
+		Secure:   s.Secure,
+		HTTPOnly: true,
+		SameSite: s.SameSite,
+	})
+	// readable by the page so it can send it back in CSRFHeader
+	c.Cookie(&fiber.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrf,
+		Path:     "/",
+		Domain:   s.Domain,
+		Expires:  expires,
+		Secure:   s.Secure,
+		SameSite: s.SameSite,
+	})
+}
+
+// Clear removes both cookies.
+func (s SessionCookies) Clear(c *fiber.Ctx) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Path:     "/",
+			Domain:   s.Domain,
+			Expires:  time.Unix(0, 0),
+			Secure:   s.Secure,
+			HTTPOnly: name == SessionCookie,
+			SameSite: s.SameSite,
+		})
+	}
+}
+
+// validCSRF reports whether a cookie-authenticated request may proceed: safe
+// methods always may, others must send the CSRF cookie's value in CSRFHeader.
+func validCSRF(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	cookie := c.Cookies(CSRFCookie)
+	header := c.Get(CSRFHeader)
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
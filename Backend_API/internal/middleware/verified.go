@@ -0,0 +1,37 @@
+// internal/middleware/verified.go
+package middleware
+
+import (
+	"first_task/go-fiber-api/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail blocks callers whose email address is not verified yet.
+// When enabled is false it lets every request through. It must run after the
+// JWT middleware.
+func RequireVerifiedEmail(users *services.UserService, enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !enabled {
+			return c.Next()
+		}
+		userID, err := CurrentUserID(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or missing token",
+			})
+		}
+		user, err := users.GetUserByID(userID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+		if user.EmailVerifiedAt == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "email address not verified",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit log actions.
+const (
+	AuditImpersonate = "impersonate" // an admin started impersonating a user
+	AuditRequest     = "request"     // a request made while impersonating
+)
+
+// AuditLog records what an admin did while acting as another user.
+// ActorID is the admin, SubjectID the user they acted as.
+type AuditLog struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Action    string    `gorm:"size:20;not null" json:"action"`
+	ActorID   int       `gorm:"not null;index" json:"actor_id"`
+	SubjectID int       `gorm:"not null;index" json:"subject_id"`
+	Method    string    `gorm:"size:10" json:"method"`
+	Path      string    `gorm:"size:255" json:"path"`
+	Status    int       `json:"status"`
+	Blocked   bool      `gorm:"not null;default:false" json:"blocked"` // a mutation refused under impersonation
+	IP        string    `gorm:"size:45" json:"ip"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// AuthorizationCode is a one-time code handed to a client at the end of the
+// authorization step and exchanged for tokens at the token endpoint. Only the
+// SHA-256 of the code is stored.
+type AuthorizationCode struct {
+	ID            int        `gorm:"primaryKey;autoIncrement"`
+	CodeHash      string     `gorm:"size:64;not null;uniqueIndex"`
+	ClientID      string     `gorm:"size:40;not null;index"`
+	UserID        int        `gorm:"not null;index"`
+	User          *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	RedirectURI   string     `gorm:"type:text;not null"`
+	Scope         string     `gorm:"size:255;not null"` // space separated
+	Nonce         string     `gorm:"size:255"`
+	CodeChallenge string     `gorm:"size:128;not null"` // PKCE S256 challenge
+	AuthTime      time.Time  `gorm:"not null"`          // when the user's session was authenticated
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	UsedAt        *time.Time // set once the code is exchanged
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
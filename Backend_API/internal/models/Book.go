@@ -1,13 +1,21 @@
 package models
 
+import "gorm.io/gorm"
+
+// Book is a catalog title. Title, Author, Genre and Description share the
+// ft_books FULLTEXT index queried by the MySQL search driver.
 type Book struct {
 	ID            int    `gorm:"primaryKey;autoIncrement" json:"id"`
-	Title         string `gorm:"size:255;not null" json:"title"`
+	Title         string `gorm:"size:255;not null;index:ft_books,class:FULLTEXT" json:"title"`
+	Author        string `gorm:"size:255;index:ft_books,class:FULLTEXT" json:"author"`
 	PublishedYear int    `json:"published_year"`
 	Quantity      int    `json:"quantity"`
-	Genre         string `gorm:"size:100" json:"genre"`
+	Genre         string `gorm:"size:100;index:ft_books,class:FULLTEXT" json:"genre"`
+	Description   string `gorm:"type:text;index:ft_books,class:FULLTEXT" json:"description"`
 	Img_url       string `json:"img_url"`
 
 	PublisherID int   `json:"publisher_id"` // Foreign Key
 	Publisher   *User `gorm:"foreignKey:PublisherID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"publisher,omitempty"`
+
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"` // soft delete, keeps loan history intact
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Hold statuses. A hold waits in a FIFO queue per book until a returned copy is
+// reserved for it (ready); it then closes as fulfilled, cancelled or expired.
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// Hold is a user's place in the waitlist for an out-of-stock book.
+type Hold struct {
+	ID        int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	BookID    int        `gorm:"not null;index" json:"book_id"`
+	Book      *Book      `gorm:"foreignKey:BookID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"book,omitempty"`
+	UserID    int        `gorm:"not null;index" json:"user_id"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"user,omitempty"`
+	Status    string     `gorm:"size:20;not null;index" json:"status"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"` // queue order
+	ReadyAt   *time.Time `json:"ready_at"`
+	ExpiresAt *time.Time `json:"expires_at"` // end of the pickup window once ready
+	ClosedAt  *time.Time `json:"closed_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Ledger entry kinds. Charges increase what a user owes; payments and waivers reduce it.
+const (
+	LedgerCharge  = "charge"
+	LedgerPayment = "payment"
+	LedgerWaiver  = "waiver"
+)
+
+// LedgerEntry is one line of a user's account. AmountCents is positive for
+// charges and negative for payments and waivers, so the balance is their sum.
+type LedgerEntry struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int       `gorm:"not null;index" json:"user_id"`
+	User        *User     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"user,omitempty"`
+	LoanID      *int      `gorm:"index" json:"loan_id"` // the late return a charge is for
+	Kind        string    `gorm:"size:20;not null" json:"kind"`
+	AmountCents int       `gorm:"not null" json:"amount_cents"`
+	Note        string    `gorm:"size:255" json:"note"`
+	RecordedBy  *int      `json:"recorded_by"` // staff member who recorded a payment or waiver
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
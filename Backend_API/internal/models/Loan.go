@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Loan records a single copy of a book being checked out by a user.
+// An open loan has a nil ReturnedAt.
+type Loan struct {
+	ID           int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	BookID       int        `gorm:"not null;index" json:"book_id"`
+	Book         *Book      `gorm:"foreignKey:BookID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"book,omitempty"`
+	UserID       int        `gorm:"not null;index" json:"user_id"` // borrower, taken from the JWT sub
+	User         *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"user,omitempty"`
+	CheckedOutAt time.Time  `gorm:"not null" json:"checked_out_at"`
+	DueAt        *time.Time `json:"due_at"`
+	ReturnedAt   *time.Time `gorm:"index" json:"returned_at"`
+	Renewals     int        `gorm:"not null;default:0" json:"renewals"`
+	Overdue      bool       `gorm:"not null;default:false;index" json:"overdue"` // set by the overdue sweeper
+}
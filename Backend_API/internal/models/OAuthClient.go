@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is an application registered to sign users in through the
+// built-in OpenID Connect provider. Confidential clients authenticate to the
+// token endpoint with a secret, of which only the SHA-256 is stored; public
+// clients (SPAs, CLIs) have none and rely on PKCE alone.
+type OAuthClient struct {
+	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ClientID     string    `gorm:"size:40;not null;uniqueIndex" json:"client_id"`
+	Name         string    `gorm:"size:100;not null" json:"name"`
+	SecretHash   string    `gorm:"size:64" json:"-"`
+	Confidential bool      `gorm:"not null;default:false" json:"confidential"`
+	RedirectURIs string    `gorm:"type:text;not null" json:"redirect_uris"` // space separated, matched exactly
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// RedirectURIList returns the client's registered redirect URIs as a slice.
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// AllowsRedirectURI reports whether uri is one of the client's redirect URIs.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIList() {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
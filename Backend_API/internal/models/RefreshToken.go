@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken tracks an issued refresh token so that each one can be used
+// only once. Tokens rotated from the same login share a FamilyID.
+type RefreshToken struct {
+	ID        string     `gorm:"primaryKey;size:64" json:"-"` // SHA-256 of the token's jti
+	UserID    int        `gorm:"not null;index" json:"user_id"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	FamilyID  string     `gorm:"size:64;not null;index" json:"family_id"`
+	Scope     string     `gorm:"size:255" json:"scope"` // scopes requested at login, empty for all
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
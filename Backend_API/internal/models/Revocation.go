@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken is an access token revoked before its expiry, kept until ExpiresAt.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// SessionRevocation invalidates every access token issued to a user at or
+// before RevokedAt. It can be dropped once ExpiresAt passes, because all such
+// tokens have expired by then.
+type SessionRevocation struct {
+	UserID    int       `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	RevokedAt time.Time `gorm:"not null" json:"revoked_at"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+// OAuth2-style scopes. A token or API key may carry fewer scopes than its
+// user's role allows, never more.
+const (
+	ScopeBooksRead  = "books:read"
+	ScopeBooksWrite = "books:write"
+	ScopeLoansRead  = "loans:read"  // loans, holds and their queues
+	ScopeLoansWrite = "loans:write" // checkout, checkin, renewals and holds
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write" // your own profile, 2FA and API keys
+	ScopeUsersAdmin = "users:admin" // other users' accounts, payments and sessions
+)
+
+// OpenID Connect scopes. They only expose the user's own identity, so every
+// role may grant them, but they are never granted unless asked for.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var identityScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+var memberScopes = []string{ScopeBooksRead, ScopeLoansRead, ScopeLoansWrite, ScopeUsersRead, ScopeUsersWrite}
+
+var roleScopes = map[string][]string{
+	RoleMember:    memberScopes,
+	RolePublisher: append([]string{ScopeBooksWrite}, memberScopes...),
+	RoleAdmin:     append([]string{ScopeBooksWrite, ScopeUsersAdmin}, memberScopes...),
+}
+
+// RoleScopes returns every scope role may grant.
+func RoleScopes(role string) []string {
+	return append([]string(nil), roleScopes[role]...)
+}
+
+// IdentityScopes returns the OpenID Connect scopes.
+func IdentityScopes() []string {
+	return append([]string(nil), identityScopes...)
+}
+
+// RoleAllowsScope reports whether role may grant scope.
+func RoleAllowsScope(role, scope string) bool {
+	if ValidRole(role) && isIdentityScope(scope) {
+		return true
+	}
+	for _, s := range roleScopes[role] {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentityScope(scope string) bool {
+	for _, s := range identityScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -2,19 +2,47 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles a user can hold. Members borrow books, publishers also add books to
+// the catalog and admins manage everything.
+const (
+	RoleAdmin     = "admin"
+	RolePublisher = "publisher"
+	RoleMember    = "member"
 )
 
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RolePublisher || role == RoleMember
+}
+
 // snake case for database and json data
 type User struct {
-	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	FirstName      string    `json:"first_name"`
-	LastName       string    `json:"last_name"`
-	Email          string    `json:"email"`
-	Password       string    `json:"-"` // hidden from JSON
-	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
-	ImgSrc         string    `json:"img_src"`
-	BooksPublished []Book    `gorm:"foreignKey:PublisherID" json:"books"`
+	ID              int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	Email           string         `gorm:"size:255;uniqueIndex:idx_users_live_email,priority:1" json:"email"`
+	Password        string         `json:"-"` // hidden from JSON
+	Role            string         `gorm:"size:20;not null;default:member" json:"role"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`
+	TOTPSecret      string         `gorm:"size:64" json:"-"` // set on enrollment, active once TOTPEnabled
+	TOTPEnabled     bool           `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep    int64          `gorm:"not null;default:0" json:"-"` // last accepted time step, stops code replay
+	FailedLogins    int            `gorm:"not null;default:0" json:"-"`
+	LockedUntil     *time.Time     `json:"locked_until"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"` // soft delete, the user's books and loans stay
+	ImgSrc          string         `json:"img_src"`
+	BooksPublished  []Book         `gorm:"foreignKey:PublisherID" json:"books"`
+
+	// Live is 1 until the user is deleted and NULL afterwards. A unique index
+	// may repeat NULLs, so emails are unique among live users only and a
+	// deleted user's address can be registered again.
+	Live *bool `gorm:"->;type:tinyint(1) GENERATED ALWAYS AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL;uniqueIndex:idx_users_live_email,priority:2" json:"-"`
 }
 
 type PublisherWithCount struct {
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyRepo struct {
+	DB *gorm.DB
+}
+
+func (r *APIKeyRepo) CreateAPIKey(key *models.APIKey) error {
+	return r.DB.Create(key).Error
+}
+
+// GetAPIKeysByUser returns every key of the user, revoked ones included, newest first.
+func (r *APIKeyRepo) GetAPIKeysByUser(userID int) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	result := r.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys)
+	return keys, result.Error
+}
+
+// GetAPIKeyByHash looks a key up by the SHA-256 of the full key.
+func (r *APIKeyRepo) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.DB.Where("key_hash = ?", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey revokes the user's key with this ID. Keys of other users and
+// keys that are already revoked yield ErrAPIKeyNotFound.
+func (r *APIKeyRepo) RevokeAPIKey(id int, userID int) error {
+	res := r.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeUserAPIKeys revokes every key of the user that is not revoked yet.
+func (r *APIKeyRepo) RevokeUserAPIKeys(userID int) error {
+	return r.DB.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchAPIKey records when the key was last used.
+func (r *APIKeyRepo) TouchAPIKey(id int, at time.Time) error {
+	return r.DB.Model(&models.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
@@ -0,0 +1,26 @@
+package repo
+
+import (
+	"first_task/go-fiber-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepo struct {
+	DB *gorm.DB
+}
+
+func (r *AuditRepo) CreateEntry(entry *models.AuditLog) error {
+	return r.DB.Create(entry).Error
+}
+
+// GetEntries returns the newest limit entries, only those of actorID when it is not 0.
+func (r *AuditRepo) GetEntries(actorID int, limit int) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	query := r.DB.Order("created_at DESC, id DESC").Limit(limit)
+	if actorID != 0 {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	result := query.Find(&entries)
+	return entries, result.Error
+}
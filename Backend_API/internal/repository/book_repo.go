@@ -3,8 +3,20 @@ package repo
 import (
 	"errors"
 	"first_task/go-fiber-api/internal/models"
+	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBookNotFound      = errors.New("book not found")
+	ErrBookUnavailable   = errors.New("book not available for checkout")
+	ErrNoActiveLoan      = errors.New("no active loan for this book")
+	ErrBookInUse         = errors.New("book has open loans or holds")
+	ErrBookNotDeleted    = errors.New("book is not deleted")
+	ErrPublisherNotFound = errors.New("publisher not found")
 )
 
 type BookRepo struct {
@@ -14,40 +26,320 @@ type BookRepo struct {
 func (r *BookRepo) CreateBook(book *models.Book) error {
 	return r.DB.Create(book).Error
 }
-func (r *BookRepo) GetAllBooks(search string) ([]models.Book, error) {
-	var books []models.Book
 
+// BookFilter selects, orders and pages the books GetBooks returns. Zero
+// values leave a filter off.
+type BookFilter struct {
+	Search         string // title or genre contains
+	Genre          string
+	PublisherID    int
+	YearFrom       int
+	YearTo         int
+	Available      bool // only books with copies on the shelf
+	IncludeDeleted bool
+
+	SortBy string // "id", "title", "published_year" or "quantity"; ties are broken by id
+	Desc   bool
+	Limit  int
+	Offset int
+	After  *BookCursor // keyset pagination, used instead of Offset
+}
+
+// BookCursor is the position after which the next page starts: the sort
+// column's value and the ID of the last book of the previous page.
+type BookCursor struct {
+	Value any
+	ID    int
+}
+
+var bookSortColumns = map[string]bool{"id": true, "title": true, "published_year": true, "quantity": true}
+
+// GetBooks returns one page of the books matching f, together with the
+// number of matching books across all pages.
+func (r *BookRepo) GetBooks(f BookFilter) ([]models.Book, int64, error) {
+	if !bookSortColumns[f.SortBy] {
+		return nil, 0, fmt.Errorf("cannot sort books by %q", f.SortBy)
+	}
 	query := r.DB.Model(&models.Book{})
-	if search != "" {
-		like := "%" + search + "%"
+	if f.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if f.Search != "" {
+		like := "%" + f.Search + "%"
 		query = query.Where("title LIKE ? OR genre LIKE ?", like, like)
 	}
-	result := query.Find(&books)
-	return books, result.Error
+	if f.Genre != "" {
+		query = query.Where("genre = ?", f.Genre)
+	}
+	if f.PublisherID != 0 {
+		query = query.Where("publisher_id = ?", f.PublisherID)
+	}
+	if f.YearFrom != 0 {
+		query = query.Where("published_year >= ?", f.YearFrom)
+	}
+	if f.YearTo != 0 {
+		query = query.Where("published_year <= ?", f.YearTo)
+	}
+	if f.Available {
+		query = query.Where("quantity > 0")
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if f.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if f.After != nil {
+		if f.SortBy == "id" {
+			query = query.Where("id "+cmp+" ?", f.After.ID)
+		} else {
+			query = query.Where("("+f.SortBy+" "+cmp+" ?) OR ("+f.SortBy+" = ? AND id "+cmp+" ?)",
+				f.After.Value, f.After.Value, f.After.ID)
+		}
+	} else if f.Offset > 0 {
+		query = query.Offset(f.Offset)
+	}
+	if f.SortBy != "id" {
+		query = query.Order(f.SortBy + " " + dir)
+	}
+	var books []models.Book
+	err := query.Order("id " + dir).Limit(f.Limit).Find(&books).Error
+	return books, total, err
+}
+
+// GetAllBooks returns every book that is not deleted.
+func (r *BookRepo) GetAllBooks() ([]models.Book, error) {
+	var books []models.Book
+	err := r.DB.Find(&books).Error
+	return books, err
 }
+
+// GetBooksByIDs returns the books with the given IDs, in no particular order.
+// Deleted and unknown IDs are left out.
+func (r *BookRepo) GetBooksByIDs(ids []int) ([]models.Book, error) {
+	var books []models.Book
+	if len(ids) == 0 {
+		return books, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Find(&books).Error
+	return books, err
+}
+
+// BookMatch is a book found by SearchBooks and its relevance.
+type BookMatch struct {
+	models.Book
+	Score float64
+}
+
+const bookFulltext = "MATCH (title, author, genre, description) AGAINST (? IN BOOLEAN MODE)"
+
+// SearchBooks runs a boolean-mode query against the ft_books FULLTEXT index
+// and returns up to limit books, most relevant first.
+func (r *BookRepo) SearchBooks(boolean string, limit int) ([]BookMatch, error) {
+	var matches []BookMatch
+	err := r.DB.Model(&models.Book{}).
+		Select("books.*, "+bookFulltext+" AS score", boolean).
+		Where(bookFulltext, boolean).
+		Order("score DESC, id ASC").
+		Limit(limit).
+		Scan(&matches).Error
+	return matches, err
+}
+
 func (r *BookRepo) GetBookByID(id int) (*models.Book, error) {
 	var book models.Book
-	result := r.DB.First(&book, id)
-	return &book, result.Error
+	err := r.DB.First(&book, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
 }
-func (r *BookRepo) Checkin(id int) error {
-	var book models.Book
-	results := r.DB.First(&book, id)
-	if results.Error != nil {
-		return results.Error
+
+// UpdateBook sets the given columns of the book. Columns that are not in
+// fields keep their value.
+func (r *BookRepo) UpdateBook(id int, fields map[string]any) error {
+	if len(fields) == 0 {
+		return bookMissingOr(r.DB, id, nil)
+	}
+	res := r.DB.Model(&models.Book{}).Where("id = ?", id).Updates(fields)
+	if errors.Is(res.Error, gorm.ErrForeignKeyViolated) {
+		return ErrPublisherNotFound
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// MySQL reports 0 rows for an update that changes nothing, so check the row exists
+		return bookMissingOr(r.DB, id, nil)
 	}
-	book.Quantity = book.Quantity + 1
-	return r.DB.Save(&book).Error
+	return nil
 }
-func (r *BookRepo) Checkout(id int) error {
-	var book models.Book
-	results := r.DB.First(&book, id)
-	if results.Error != nil {
-		return results.Error
+
+// DeleteBook soft-deletes the book, so its loan history stays intact. Books
+// with copies on loan or users waiting for them cannot be deleted.
+func (r *BookRepo) DeleteBook(id int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var open int64
+		if err := tx.Model(&models.Loan{}).Where("book_id = ? AND returned_at IS NULL", id).Count(&open).Error; err != nil {
+			return err
+		}
+		if open == 0 {
+			err = tx.Model(&models.Hold{}).
+				Where("book_id = ? AND status IN ?", id, []string{models.HoldWaiting, models.HoldReady}).
+				Count(&open).Error
+			if err != nil {
+				return err
+			}
+		}
+		if open > 0 {
+			return ErrBookInUse
+		}
+		return tx.Delete(&book).Error
+	})
+}
+
+// RestoreBook undoes a soft delete.
+func (r *BookRepo) RestoreBook(id int) error {
+	res := r.DB.Unscoped().Model(&models.Book{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		if err := r.DB.Model(&models.Book{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrBookNotFound
+		}
+		return ErrBookNotDeleted
+	}
+	return nil
+}
+
+// Checkin returns a copy of the book and closes the caller's open loan for it.
+// The loan row is locked and closed with a conditional update, so a duplicate
+// checkin cannot return the same copy twice. If users are waiting for the book,
+// the copy is reserved for the next hold until readyUntil instead of restocked.
+// fine, when set, is called with the closed loan and any positive amount it
+// returns is charged to the borrower in the same transaction.
+func (r *BookRepo) Checkin(id int, userID int, readyUntil time.Time, fine func(loan *models.Loan) int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var loan models.Loan
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("book_id = ? AND user_id = ? AND returned_at IS NULL", id, userID).
+			Order("checked_out_at ASC").
+			First(&loan).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return bookMissingOr(tx, id, ErrNoActiveLoan)
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		res := tx.Model(&models.Loan{}).
+			Where("id = ? AND returned_at IS NULL", loan.ID).
+			Update("returned_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoActiveLoan
+		}
+		loan.ReturnedAt = &now
+		if fine != nil {
+			if cents := fine(&loan); cents > 0 {
+				charge := models.LedgerEntry{
+					UserID:      userID,
+					LoanID:      &loan.ID,
+					Kind:        models.LedgerCharge,
+					AmountCents: cents,
+					Note:        "late return fine",
+				}
+				if err := tx.Create(&charge).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return releaseCopy(tx, id, readyUntil)
+	})
+}
+
+// Checkout takes a copy of the book and opens a loan for the caller.
+// A copy reserved by the caller's ready hold is used first; otherwise stock is
+// decremented with a single conditional UPDATE so concurrent checkouts can
+// never drive the quantity below zero. Reserved copies are not part of the
+// quantity, so nobody else can take them during the pickup window.
+func (r *BookRepo) Checkout(id int, userID int, dueAt time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		loan := models.Loan{
+			BookID:       id,
+			UserID:       userID,
+			CheckedOutAt: time.Now(),
+			DueAt:        &dueAt,
+		}
+
+		// a reservation past its pickup window belongs to the next user, even
+		// before the sweeper has passed it on
+		var hold models.Hold
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("book_id = ? AND user_id = ? AND status = ? AND expires_at > ?", id, userID, models.HoldReady, loan.CheckedOutAt).
+			First(&hold).Error
+		if err == nil {
+			if err := closeHold(tx, hold.ID, models.HoldFulfilled); err != nil {
+				return err
+			}
+			return tx.Create(&loan).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		res := tx.Model(&models.Book{}).
+			Where("id = ? AND quantity > 0", id).
+			UpdateColumn("quantity", gorm.Expr("quantity - 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return bookMissingOr(tx, id, ErrBookUnavailable)
+		}
+		// a shelf copy satisfies any place the caller still holds in the queue
+		err = tx.Model(&models.Hold{}).
+			Where("book_id = ? AND user_id = ? AND status = ?", id, userID, models.HoldWaiting).
+			Updates(map[string]any{"status": models.HoldFulfilled, "closed_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&loan).Error
+	})
+}
+
+// bookMissingOr returns ErrBookNotFound when the book does not exist, otherwise err.
+func bookMissingOr(tx *gorm.DB, id int, err error) error {
+	var count int64
+	if e := tx.Model(&models.Book{}).Where("id = ?", id).Count(&count).Error; e != nil {
+		return e
 	}
-	if book.Quantity == 0 {
-		return errors.New("book not available for checkout")
+	if count == 0 {
+		return ErrBookNotFound
 	}
-	book.Quantity = book.Quantity - 1
-	return r.DB.Save(&book).Error
+	return err
 }
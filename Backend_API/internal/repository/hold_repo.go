@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrHoldNotFound  = errors.New("hold not found")
+	ErrNotHolder     = errors.New("hold belongs to another user")
+	ErrHoldClosed    = errors.New("hold is no longer active")
+	ErrHoldExists    = errors.New("you already have an active hold on this book")
+	ErrBookAvailable = errors.New("book has copies available, check it out instead")
+)
+
+type HoldRepo struct {
+	DB *gorm.DB
+}
+
+// CreateHold adds the user to the end of the book's waitlist.
+func (r *HoldRepo) CreateHold(bookID int, userID int) (*models.Hold, error) {
+	hold := models.Hold{
+		BookID: bookID,
+		UserID: userID,
+		Status: models.HoldWaiting,
+	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, bookID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if book.Quantity > 0 {
+			return ErrBookAvailable
+		}
+		var count int64
+		err = tx.Model(&models.Hold{}).
+			Where("book_id = ? AND user_id = ? AND status IN ?", bookID, userID, []string{models.HoldWaiting, models.HoldReady}).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrHoldExists
+		}
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// GetHoldsByBook returns the book's holds in queue order.
+func (r *HoldRepo) GetHoldsByBook(bookID int) ([]models.Hold, error) {
+	var holds []models.Hold
+	result := r.DB.Preload("User").
+		Where("book_id = ?", bookID).
+		Order("created_at ASC, id ASC").
+		Find(&holds)
+	return holds, result.Error
+}
+
+// GetHoldsByUser returns the user's holds, newest first.
+func (r *HoldRepo) GetHoldsByUser(userID int) ([]models.Hold, error) {
+	var holds []models.Hold
+	result := r.DB.Preload("Book").
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&holds)
+	return holds, result.Error
+}
+
+// CancelHold closes the user's active hold. Cancelling a ready hold passes the
+// reserved copy on to the next user in the queue, reserved until readyUntil.
+func (r *HoldRepo) CancelHold(id int, userID int, readyUntil time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var hold models.Hold
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hold, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrHoldNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if hold.UserID != userID {
+			return ErrNotHolder
+		}
+		if hold.Status != models.HoldWaiting && hold.Status != models.HoldReady {
+			return ErrHoldClosed
+		}
+		if err := closeHold(tx, hold.ID, models.HoldCancelled); err != nil {
+			return err
+		}
+		if hold.Status == models.HoldReady {
+			return releaseCopy(tx, hold.BookID, readyUntil)
+		}
+		return nil
+	})
+}
+
+// ExpireHolds closes ready holds whose pickup window ended before now and
+// passes each reserved copy on. It returns how many holds expired.
+func (r *HoldRepo) ExpireHolds(now time.Time, readyUntil time.Time) (int, error) {
+	var holds []models.Hold
+	err := r.DB.Where("status = ? AND expires_at < ?", models.HoldReady, now).Find(&holds).Error
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, h := range holds {
+		err := r.DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.Hold{}).
+				Where("id = ? AND status = ?", h.ID, models.HoldReady).
+				Updates(map[string]any{"status": models.HoldExpired, "closed_at": now})
+			if res.Error != nil || res.RowsAffected == 0 {
+				// already picked up or cancelled in the meantime
+				return res.Error
+			}
+			expired++
+			return releaseCopy(tx, h.BookID, readyUntil)
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// releaseCopy hands a returned copy to the oldest waiting hold on the book,
+// reserving it until readyUntil, or puts it back on the shelf when nobody is waiting.
+func releaseCopy(tx *gorm.DB, bookID int, readyUntil time.Time) error {
+	var next models.Hold
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("book_id = ? AND status = ?", bookID, models.HoldWaiting).
+		Order("created_at ASC, id ASC").
+		First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Model(&models.Book{}).
+			Where("id = ?", bookID).
+			UpdateColumn("quantity", gorm.Expr("quantity + 1")).Error
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&next).Updates(map[string]any{
+		"status":     models.HoldReady,
+		"ready_at":   time.Now(),
+		"expires_at": readyUntil,
+	}).Error
+}
+
+func closeHold(tx *gorm.DB, id int, status string) error {
+	return tx.Model(&models.Hold{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"status": status, "closed_at": time.Now()}).Error
+}
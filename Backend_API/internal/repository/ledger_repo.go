@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"first_task/go-fiber-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type LedgerRepo struct {
+	DB *gorm.DB
+}
+
+func (r *LedgerRepo) CreateEntry(entry *models.LedgerEntry) error {
+	return r.DB.Create(entry).Error
+}
+
+// GetBalance returns what the user owes in cents (charges minus payments and waivers).
+func (r *LedgerRepo) GetBalance(userID int) (int, error) {
+	var balance int
+	result := r.DB.Model(&models.LedgerEntry{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("user_id = ?", userID).
+		Scan(&balance)
+	return balance, result.Error
+}
+
+// GetEntriesByUser returns the user's ledger, newest first.
+func (r *LedgerRepo) GetEntriesByUser(userID int) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	result := r.DB.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&entries)
+	return entries, result.Error
+}
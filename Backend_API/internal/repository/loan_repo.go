@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLoanNotFound = errors.New("loan not found")
+	ErrNotBorrower  = errors.New("loan belongs to another user")
+	ErrLoanClosed   = errors.New("loan already returned")
+	ErrLoanOverdue  = errors.New("overdue loans cannot be renewed")
+	ErrRenewalLimit = errors.New("renewal limit reached")
+	ErrHoldsWaiting = errors.New("other users are waiting for this book")
+)
+
+type LoanRepo struct {
+	DB *gorm.DB
+}
+
+// GetLoansByBook returns every loan (open and returned) for a book, newest first.
+func (r *LoanRepo) GetLoansByBook(bookID int) ([]models.Loan, error) {
+	var loans []models.Loan
+	result := r.DB.Preload("User").
+		Where("book_id = ?", bookID).
+		Order("checked_out_at DESC, id DESC").
+		Find(&loans)
+	return loans, result.Error
+}
+
+// GetLoansByUser returns every loan (open and returned) for a borrower, newest first.
+func (r *LoanRepo) GetLoansByUser(userID int) ([]models.Loan, error) {
+	var loans []models.Loan
+	result := r.DB.Preload("Book").
+		Where("user_id = ?", userID).
+		Order("checked_out_at DESC, id DESC").
+		Find(&loans)
+	return loans, result.Error
+}
+
+// GetOverdueLoans returns open loans whose due date has passed, oldest due first.
+func (r *LoanRepo) GetOverdueLoans(now time.Time) ([]models.Loan, error) {
+	var loans []models.Loan
+	result := r.DB.Preload("Book").Preload("User").
+		Where("returned_at IS NULL AND due_at < ?", now).
+		Order("due_at ASC, id ASC").
+		Find(&loans)
+	return loans, result.Error
+}
+
+// MarkOverdue flags every open loan that is past its due date and returns how many were flagged.
+func (r *LoanRepo) MarkOverdue(now time.Time) (int64, error) {
+	res := r.DB.Model(&models.Loan{}).
+		Where("returned_at IS NULL AND overdue = ? AND due_at < ?", false, now).
+		Update("overdue", true)
+	return res.RowsAffected, res.Error
+}
+
+// RenewLoan pushes the due date of the borrower's open loan back by period.
+func (r *LoanRepo) RenewLoan(id int, userID int, maxRenewals int, period time.Duration) (*models.Loan, error) {
+	var loan models.Loan
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&loan, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrLoanNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if loan.UserID != userID {
+			return ErrNotBorrower
+		}
+		if loan.ReturnedAt != nil {
+			return ErrLoanClosed
+		}
+		now := time.Now()
+		if loan.Overdue || (loan.DueAt != nil && loan.DueAt.Before(now)) {
+			return ErrLoanOverdue
+		}
+		if loan.Renewals >= maxRenewals {
+			return ErrRenewalLimit
+		}
+		var waiting int64
+		err = tx.Model(&models.Hold{}).
+			Where("book_id = ? AND status = ?", loan.BookID, models.HoldWaiting).
+			Count(&waiting).Error
+		if err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return ErrHoldsWaiting
+		}
+		due := now
+		if loan.DueAt != nil {
+			due = *loan.DueAt
+		}
+		due = due.Add(period)
+		loan.DueAt = &due
+		loan.Renewals = loan.Renewals + 1
+		return tx.Model(&loan).Updates(map[string]any{
+			"due_at":   loan.DueAt,
+			"renewals": loan.Renewals,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
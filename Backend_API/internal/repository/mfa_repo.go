@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication already enabled")
+	ErrTOTPStepUsed        = errors.New("totp code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+)
+
+type MFARepo struct {
+	DB *gorm.DB
+}
+
+// StartEnrollment stores a new, not yet enabled TOTP secret for the user and
+// replaces their recovery codes with codeHashes. enabled is whether the user
+// had two-factor login on when the caller checked: re-enrolling turns it off
+// until the new secret is confirmed, and a user whose state changed in the
+// meantime yields ErrTOTPAlreadyEnabled.
+func (r *MFARepo) StartEnrollment(userID int, secret string, codeHashes []string, enabled bool) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND totp_enabled = ?", userID, enabled).
+			Updates(map[string]any{"totp_secret": secret, "totp_enabled": false, "totp_last_step": 0})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return userMissingOrEnabled(tx, userID)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// EnableTOTP turns on two-factor login for the user and records step as used.
+func (r *MFARepo) EnableTOTP(userID int, step int64) error {
+	return r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]any{"totp_enabled": true, "totp_last_step": step}).Error
+}
+
+// ResetTOTP turns off two-factor login for the user and drops their secret
+// and recovery codes, e.g. after they lost their authenticator.
+func (r *MFARepo) ResetTOTP(userID int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
+		err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]any{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// UseTOTPStep records step as the user's last accepted TOTP step. The update
+// is conditional, so a step at or before the last one yields ErrTOTPStepUsed.
+func (r *MFARepo) UseTOTPStep(userID int, step int64) error {
+	res := r.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTOTPStepUsed
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks the user's unused recovery code with this hash as used.
+func (r *MFARepo) ConsumeRecoveryCode(userID int, hash string) error {
+	res := r.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// userMissingOrEnabled returns ErrUserNotFound when the user does not exist,
+// otherwise ErrTOTPAlreadyEnabled.
+func userMissingOrEnabled(tx *gorm.DB, userID int) error {
+	var count int64
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return ErrTOTPAlreadyEnabled
+}
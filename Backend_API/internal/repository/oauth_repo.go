@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrAuthCodeInvalid     = errors.New("authorization code is invalid, expired or already used")
+)
+
+type OAuthRepo struct {
+	DB *gorm.DB
+}
+
+func (r *OAuthRepo) CreateClient(client *models.OAuthClient) error {
+	return r.DB.Create(client).Error
+}
+
+func (r *OAuthRepo) GetClients() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	result := r.DB.Order("created_at DESC, id DESC").Find(&clients)
+	return clients, result.Error
+}
+
+func (r *OAuthRepo) GetClientByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.DB.Where("client_id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// DeleteClient removes the client and its pending authorization codes.
+func (r *OAuthRepo) DeleteClient(clientID string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("client_id = ?", clientID).Delete(&models.OAuthClient{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOAuthClientNotFound
+		}
+		return tx.Where("client_id = ?", clientID).Delete(&models.AuthorizationCode{}).Error
+	})
+}
+
+func (r *OAuthRepo) CreateAuthCode(code *models.AuthorizationCode) error {
+	return r.DB.Create(code).Error
+}
+
+// ConsumeAuthCode marks the code with this hash used and returns it. The
+// conditional update makes sure a code is exchanged at most once, even by
+// concurrent requests.
+func (r *OAuthRepo) ConsumeAuthCode(hash string, now time.Time) (*models.AuthorizationCode, error) {
+	res := r.DB.Model(&models.AuthorizationCode{}).
+		Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrAuthCodeInvalid
+	}
+	var code models.AuthorizationCode
+	if err := r.DB.Where("code_hash = ?", hash).First(&code).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// DeleteExpiredAuthCodes removes codes that expired before now, used or not.
+func (r *OAuthRepo) DeleteExpiredAuthCodes(now time.Time) (int64, error) {
+	res := r.DB.Where("expires_at <= ?", now).Delete(&models.AuthorizationCode{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevocationRepo struct {
+	DB *gorm.DB
+}
+
+func (r *RevocationRepo) RevokeToken(jti string, expiresAt time.Time) error {
+	token := models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&token).Error
+}
+
+func (r *RevocationRepo) IsTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// RevokeUser records (or moves forward) the user's session cut-off.
+func (r *RevocationRepo) RevokeUser(userID int, at time.Time, expiresAt time.Time) error {
+	rev := models.SessionRevocation{UserID: userID, RevokedAt: at, ExpiresAt: expiresAt}
+	return r.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_at", "expires_at"}),
+	}).Create(&rev).Error
+}
+
+// GetUserRevocation returns the user's session cut-off, or nil when there is none.
+func (r *RevocationRepo) GetUserRevocation(userID int) (*models.SessionRevocation, error) {
+	var rev models.SessionRevocation
+	err := r.DB.First(&rev, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// DeleteExpired drops revocations that no longer matter because the tokens they cover have expired.
+func (r *RevocationRepo) DeleteExpired(now time.Time) error {
+	if err := r.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return r.DB.Where("expires_at < ?", now).Delete(&models.SessionRevocation{}).Error
+}
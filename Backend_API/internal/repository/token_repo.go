@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token already used")
+)
+
+type TokenRepo struct {
+	DB *gorm.DB
+}
+
+func (r *TokenRepo) CreateRefreshToken(token *models.RefreshToken) error {
+	return r.DB.Create(token).Error
+}
+
+func (r *TokenRepo) GetRefreshToken(id string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.DB.Where("id = ?", id).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseRefreshToken marks the refresh token with the given hashed ID as used and
+// returns it. A token that was already used or revoked is returned together
+// with ErrRefreshTokenReused so the caller can revoke its family.
+func (r *TokenRepo) UseRefreshToken(id string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil || token.RevokedAt != nil {
+			return ErrRefreshTokenReused
+		}
+		now := time.Now()
+		token.UsedAt = &now
+		return tx.Model(&token).Update("used_at", now).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return &token, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeFamily revokes every refresh token rotated from the same login.
+func (r *TokenRepo) RevokeFamily(familyID string) error {
+	return r.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of the user.
+func (r *TokenRepo) RevokeUserRefreshTokens(userID int) error {
+	return r.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -3,8 +3,17 @@ package repo
 import (
 	"errors"
 	"first_task/go-fiber-api/internal/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrEmailTaken     = errors.New("email already registered")
+	ErrUserNotDeleted = errors.New("user is not deleted")
+	ErrEmailChanged   = errors.New("email address has changed")
 )
 
 type UserRepo struct {
@@ -12,11 +21,21 @@ type UserRepo struct {
 }
 
 func (r *UserRepo) CreateUser(user *models.User) error {
-	return r.DB.Create(user).Error
+	err := r.DB.Create(user).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrEmailTaken
+	}
+	return err
 }
-func (r *UserRepo) GetAllUsers() ([]models.User, error) {
+
+// GetAllUsers lists users, leaving out deleted ones unless includeDeleted is set.
+func (r *UserRepo) GetAllUsers(includeDeleted bool) ([]models.User, error) {
 	var users []models.User
-	result := r.DB.Find(&users)
+	query := r.DB
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+	result := query.Find(&users)
 	return users, result.Error
 }
 func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
@@ -24,23 +43,140 @@ func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
 	result := r.DB.First(&user, id)
 	return &user, result.Error
 }
+
+// GetUserByEmail looks a user up by their normalized (lower-cased) email.
+func (r *UserRepo) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	result := r.DB.Where("email = ?", email).First(&user)
+	return &user, result.Error
+}
 func (r *UserRepo) UpdateUser(user *models.User) error {
 	if user.ID == 0 {
 		return errors.New("invalid user id")
 	}
 	res := r.DB.Model(&models.User{}).
 		Where("id = ?", user.ID).
-		Select("first_name", "last_name", "email").
+		Select("first_name", "last_name", "email", "email_verified_at").
 		Updates(user)
 
+	if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
+		return ErrEmailTaken
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// MySQL reports 0 rows for an update that changes nothing, so check the row exists
+		var count int64
+		if err := r.DB.Model(&models.User{}).Where("id = ?", user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// MarkEmailVerified verifies the user's email, provided it is still email.
+// Otherwise it returns ErrEmailChanged.
+func (r *UserRepo) MarkEmailVerified(id int, email string, at time.Time) error {
+	res := r.DB.Model(&models.User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("email_verified_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrEmailChanged
+	}
+	return nil
+}
+
+// RecordFailedLogin counts a failed login for the user and returns the new
+// count. lockUntil is called with that count; a non-nil result locks the
+// account until then. Both happen in one transaction with the row locked.
+func (r *UserRepo) RecordFailedLogin(id int, lockUntil func(failures int) *time.Time) (int, error) {
+	var user models.User
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "failed_logins").
+			First(&user, id).Error
+		if err != nil {
+			return err
+		}
+		user.FailedLogins++
+		updates := map[string]any{"failed_logins": user.FailedLogins}
+		if until := lockUntil(user.FailedLogins); until != nil {
+			updates["locked_until"] = *until
+		}
+		return tx.Model(&models.User{}).Where("id = ?", id).UpdateColumns(updates).Error
+	})
+	return user.FailedLogins, err
+}
+
+// ResetFailedLogins clears the user's failed login count and any lockout.
+func (r *UserRepo) ResetFailedLogins(id int) error {
+	res := r.DB.Model(&models.User{}).Where("id = ?", id).
+		UpdateColumns(map[string]any{"failed_logins": 0, "locked_until": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		if err := r.DB.Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// DeleteUser soft-deletes the user. Their books keep them as publisher and
+// their loans and ledger stay, so the account can be restored.
+func (r *UserRepo) DeleteUser(id int) error {
+	res := r.DB.Delete(&models.User{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RestoreUser undoes a soft delete. It yields ErrEmailTaken when another
+// user registered the email in the meantime.
+func (r *UserRepo) RestoreUser(id int) error {
+	var user models.User
+	err := r.DB.Unscoped().First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !user.DeletedAt.Valid {
+		return ErrUserNotDeleted
+	}
+	res := r.DB.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	// someone may have registered the email since the deletion
+	if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
+		return ErrEmailTaken
+	}
 	if res.Error != nil {
 		return res.Error
 	}
 	if res.RowsAffected == 0 {
-		return errors.New("user not found")
+		return ErrUserNotDeleted
 	}
 	return nil
 }
+
 func (r *UserRepo) GetAllPublishersWithBookCount() ([]models.PublisherWithCount, error) {
 	var publishers []models.PublisherWithCount
 
@@ -48,7 +184,8 @@ func (r *UserRepo) GetAllPublishersWithBookCount() ([]models.PublisherWithCount,
 		SELECT DISTINCT u.id, u.first_name, u.last_name, u.email, u.created_at , u.updated_at , u.img_src,
 		       COUNT(b.id) as book_count
 		FROM users u
-		INNER JOIN books b ON u.id = b.publisher_id
+		INNER JOIN books b ON u.id = b.publisher_id AND b.deleted_at IS NULL
+		WHERE u.deleted_at IS NULL
 		GROUP BY u.id, u.first_name, u.last_name, u.email, u.created_at, u.updated_at, u.img_src
 		ORDER BY u.id
 	`
@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"first_task/go-fiber-api/internal/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger that keeps every statement it is shown.
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// dryRunDB returns a gorm handle that records statements without a server.
+func dryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	rec := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, rec
+}
+
+func TestUserEmailUniqueAmongLiveUsers(t *testing.T) {
+	db, rec := dryRunDB(t)
+	if err := db.Migrator().CreateTable(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	ddl := strings.Join(rec.statements, "\n")
+	for _, want := range []string{
+		"`live` tinyint(1) GENERATED ALWAYS AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL",
+		"UNIQUE INDEX `idx_users_live_email` (`email`,`live`)",
+	} {
+		if !strings.Contains(ddl, want) {
+			t.Errorf("users DDL lacks %s:\n%s", want, ddl)
+		}
+	}
+	if strings.Contains(ddl, "`idx_users_email`") {
+		t.Errorf("users DDL still has the old unique email index:\n%s", ddl)
+	}
+
+	// MySQL refuses writes to a generated column
+	rec.statements = nil
+	r := &UserRepo{DB: db}
+	if err := r.CreateUser(&models.User{Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if insert := strings.Join(rec.statements, "\n"); strings.Contains(insert, "`live`") {
+		t.Errorf("insert writes the generated live column: %s", insert)
+	}
+}
+
+// TestDeletedUserEmailCanBeReused needs a MySQL database it may create the
+// users and books tables in, e.g.
+// TEST_MYSQL_DSN="root:secret@tcp(127.0.0.1:3306)/bookstore_test?parseTime=true".
+func TestDeletedUserEmailCanBeReused(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Book{}, &models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	r := &UserRepo{DB: db}
+	email := fmt.Sprintf("reuse-%d@example.com", time.Now().UnixNano())
+	t.Cleanup(func() { db.Unscoped().Where("email = ?", email).Delete(&models.User{}) })
+
+	first := models.User{Email: email}
+	if err := r.CreateUser(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateUser(&models.User{Email: email}); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("second live user with the same email: err = %v, want ErrEmailTaken", err)
+	}
+	if err := r.DeleteUser(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	second := models.User{Email: email}
+	if err := r.CreateUser(&second); err != nil {
+		t.Fatalf("email of a deleted user not reusable: %v", err)
+	}
+	if got, err := r.GetUserByEmail(email); err != nil || got.ID != second.ID {
+		t.Errorf("GetUserByEmail = %+v, %v; want the new user %d", got, err, second.ID)
+	}
+	if err := r.RestoreUser(first.ID); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("restoring over a reused email: err = %v, want ErrEmailTaken", err)
+	}
+	if err := r.DeleteUser(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreUser(first.ID); err != nil {
+		t.Errorf("restore after the address was freed again: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUserTokenInvalid = errors.New("token is invalid or has expired")
+
+type UserTokenRepo struct {
+	DB *gorm.DB
+}
+
+func (r *UserTokenRepo) CreateToken(token *models.UserToken) error {
+	return r.DB.Create(token).Error
+}
+
+// ConsumeToken marks the unused, unexpired token with this hash and purpose as
+// used and returns it. Any other token yields ErrUserTokenInvalid.
+func (r *UserTokenRepo) ConsumeToken(hash string, purpose string) (*models.UserToken, error) {
+	var token *models.UserToken
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = consumeToken(tx, hash, purpose)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ResetPassword consumes a password reset token and sets its user's password
+// hash in the same transaction, so a failed update leaves the token unused.
+// Tokens of deleted users are invalid. It returns the user's ID.
+func (r *UserTokenRepo) ResetPassword(hash string, passwordHash string) (int, error) {
+	var userID int
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeToken(tx, hash, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&models.User{}).Where("id = ?", token.UserID).Update("password", passwordHash)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserTokenInvalid
+		}
+		userID = token.UserID
+		return nil
+	})
+	return userID, err
+}
+
+// consumeToken locks the token and marks it used inside tx.
+func consumeToken(tx *gorm.DB, hash string, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", hash, purpose).
+		First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token.UsedAt != nil || token.ExpiresAt.Before(now) {
+		return nil, ErrUserTokenInvalid
+	}
+	token.UsedAt = &now
+	if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetLatestToken returns the most recently issued token of the user for
+// purpose, or gorm.ErrRecordNotFound when none was ever issued.
+func (r *UserTokenRepo) GetLatestToken(userID int, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	result := r.DB.Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at DESC, id DESC").
+		First(&token)
+	return &token, result.Error
+}
+
+// InvalidateTokens marks every unused token of the user for purpose as used,
+// so only the most recently issued one works.
+func (r *UserTokenRepo) InvalidateTokens(userID int, purpose string) error {
+	return r.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
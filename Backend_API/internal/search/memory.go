@@ -0,0 +1,198 @@
+// internal/search/memory.go
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+// Field weights: a word in the title counts three times as much as one in
+// the description.
+var fieldWeights = [...]float64{3, 2, 1.5, 1} // title, author, genre, description
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type document struct {
+	book   models.Book // text fields only, for snippets
+	fields [len(fieldWeights)][]string
+	length float64 // weighted number of words
+}
+
+// MemorySearcher is an in-process inverted index ranked with BM25 over the
+// weighted book fields. It lives in memory only: fill it from the database
+// at startup and keep it current through Index and Remove. Each server has
+// its own copy.
+type MemorySearcher struct {
+	mu       sync.RWMutex
+	docs     map[int]*document
+	postings map[string]map[int]float64 // word → book → weighted frequency
+	totalLen float64
+}
+
+func NewMemorySearcher() *MemorySearcher {
+	return &MemorySearcher{docs: map[int]*document{}, postings: map[string]map[int]float64{}}
+}
+
+func (m *MemorySearcher) Index(book *models.Book) error {
+	doc := &document{book: models.Book{
+		ID: book.ID, Title: book.Title, Author: book.Author, Genre: book.Genre, Description: book.Description,
+	}}
+	for i, text := range []string{book.Title, book.Author, book.Genre, book.Description} {
+		doc.fields[i] = Tokenize(text)
+		doc.length += fieldWeights[i] * float64(len(doc.fields[i]))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(book.ID)
+	m.docs[book.ID] = doc
+	m.totalLen += doc.length
+	for i, words := range doc.fields {
+		for _, w := range words {
+			if m.postings[w] == nil {
+				m.postings[w] = map[int]float64{}
+			}
+			m.postings[w][book.ID] += fieldWeights[i]
+		}
+	}
+	return nil
+}
+
+func (m *MemorySearcher) Remove(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *MemorySearcher) remove(id int) {
+	doc, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	for _, words := range doc.fields {
+		for _, w := range words {
+			delete(m.postings[w], id)
+			if len(m.postings[w]) == 0 {
+				delete(m.postings, w)
+			}
+		}
+	}
+	m.totalLen -= doc.length
+	delete(m.docs, id)
+}
+
+func (m *MemorySearcher) Search(q string, limit int) ([]Hit, error) {
+	query := ParseQuery(q)
+	if query.Empty() {
+		return nil, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// every clause narrows the candidates and adds to their scores
+	var scores map[int]float64
+	and := func(clause map[int]float64) {
+		if scores == nil {
+			scores = clause
+			return
+		}
+		for id := range scores {
+			if s, ok := clause[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	for _, t := range query.Terms {
+		and(m.termScores(t))
+	}
+	for _, p := range query.Prefixes {
+		// a prefix scores as its best-matching completion; scanning the
+		// vocabulary is fine at catalog size
+		best := map[int]float64{}
+		for w := range m.postings {
+			if strings.HasPrefix(w, p) {
+				for id, s := range m.termScores(w) {
+					best[id] = math.Max(best[id], s)
+				}
+			}
+		}
+		and(best)
+	}
+	for _, phrase := range query.Phrases {
+		clause := map[int]float64{}
+		for _, t := range phrase {
+			for id, s := range m.termScores(t) {
+				clause[id] += s
+			}
+		}
+		for id := range clause {
+			if !m.containsPhrase(m.docs[id], phrase) {
+				delete(clause, id)
+			}
+		}
+		and(clause)
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{BookID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].BookID < hits[j].BookID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = Snippet(&m.docs[hits[i].BookID].book, query)
+	}
+	return hits, nil
+}
+
+// termScores returns the BM25 score of word for every book containing it.
+func (m *MemorySearcher) termScores(word string) map[int]float64 {
+	postings := m.postings[word]
+	scores := make(map[int]float64, len(postings))
+	if len(postings) == 0 {
+		return scores
+	}
+	n, df := float64(len(m.docs)), float64(len(postings))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	avgLen := m.totalLen / n
+	for id, tf := range postings {
+		norm := 1 - bm25B + bm25B*m.docs[id].length/avgLen
+		scores[id] = idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	return scores
+}
+
+// containsPhrase reports whether the words of phrase follow each other in
+// one of the document's fields.
+func (m *MemorySearcher) containsPhrase(doc *document, phrase []string) bool {
+	for _, words := range doc.fields {
+	next:
+		for i := 0; i+len(phrase) <= len(words); i++ {
+			for j, w := range phrase {
+				if words[i+j] != w {
+					continue next
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
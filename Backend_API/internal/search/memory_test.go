@@ -0,0 +1,70 @@
+package search
+
+import (
+	"testing"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+func hitIDs(t *testing.T, m *MemorySearcher, q string) []int {
+	t.Helper()
+	hits, err := m.Search(q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, len(hits))
+	for i, h := range hits {
+		ids[i] = h.BookID
+	}
+	return ids
+}
+
+func TestMemorySearcher(t *testing.T) {
+	m := NewMemorySearcher()
+	for _, b := range []models.Book{
+		{ID: 1, Title: "Dune", Author: "Frank Herbert", Genre: "Science Fiction"},
+		{ID: 2, Title: "Children of Dune", Author: "Frank Herbert", Genre: "Science Fiction"},
+		{ID: 3, Title: "Emma", Author: "Jane Austen", Description: "Not about dune or fiction science."},
+	} {
+		if err := m.Index(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q    string
+		want []int
+	}{
+		{"dune", []int{1, 2, 3}},      // the short title ranks first, the description last
+		{"dune herbert", []int{1, 2}}, // every word must match
+		{"chil*", []int{2}},
+		{`"science fiction"`, []int{1, 2}},
+		{"tolkien", []int{}},
+	}
+	for _, tt := range tests {
+		got := hitIDs(t, m, tt.q)
+		if len(got) != len(tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.q, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Search(%q) = %v, want %v", tt.q, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if err := m.Index(&models.Book{ID: 1, Title: "Dune Messiah"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(t, m, "herbert"); len(got) != 1 || got[0] != 2 {
+		t.Errorf("re-indexed book still matches its old author: %v", got)
+	}
+	if err := m.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(t, m, "herbert"); len(got) != 0 {
+		t.Errorf("removed book still found: %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+// internal/search/mysql.go
+package search
+
+import (
+	"strings"
+
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+)
+
+// MySQLSearcher queries the ft_books FULLTEXT index, which MySQL keeps up to
+// date by itself, so Index and Remove do nothing. Words shorter than
+// innodb_ft_min_token_size (3 by default) and stopwords are ignored.
+type MySQLSearcher struct {
+	Books *repo.BookRepo
+}
+
+func (MySQLSearcher) Index(*models.Book) error { return nil }
+
+func (MySQLSearcher) Remove(int) error { return nil }
+
+func (s MySQLSearcher) Search(q string, limit int) ([]Hit, error) {
+	query := ParseQuery(q)
+	if query.Empty() {
+		return nil, nil
+	}
+	matches, err := s.Books.SearchBooks(booleanQuery(query), limit)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, len(matches))
+	for i := range matches {
+		hits[i] = Hit{BookID: matches[i].ID, Score: matches[i].Score, Snippet: Snippet(&matches[i].Book, query)}
+	}
+	return hits, nil
+}
+
+// booleanQuery writes q in MySQL's boolean full-text syntax with every part
+// required. ParseQuery keeps only letters and digits in words, so no
+// operators can slip in.
+func booleanQuery(q *Query) string {
+	var parts []string
+	for _, t := range q.Terms {
+		parts = append(parts, "+"+t)
+	}
+	for _, p := range q.Prefixes {
+		parts = append(parts, "+"+p+"*")
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `+"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,200 @@
+// internal/search/search.go
+package search
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+// Hit is one search result. Snippet is HTML: the matching passage with the
+// matched words wrapped in <mark>, everything else escaped.
+type Hit struct {
+	BookID  int
+	Score   float64
+	Snippet string
+}
+
+// Searcher finds books by relevance. Every word, prefix and phrase of a
+// query must match; the best matches come first.
+type Searcher interface {
+	// Index adds a book or replaces its previous version.
+	Index(book *models.Book) error
+	// Remove drops a book, e.g. after it was deleted.
+	Remove(id int) error
+	// Search returns up to limit hits for the query.
+	Search(q string, limit int) ([]Hit, error)
+}
+
+// Query is a parsed search query: plain words, prefixes (written `dun*`)
+// and phrases (written `"science fiction"`), all lower-cased.
+type Query struct {
+	Terms    []string
+	Prefixes []string
+	Phrases  [][]string
+}
+
+// Empty reports whether the query has nothing to match.
+func (q *Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Prefixes) == 0 && len(q.Phrases) == 0
+}
+
+// ParseQuery splits q into words, prefixes and phrases. Anything that is not
+// a letter or digit separates words, so the result is safe to hand to a
+// search engine's own query syntax.
+func ParseQuery(q string) *Query {
+	query := &Query{}
+	seen := map[string]bool{}
+	addTerm := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			query.Terms = append(query.Terms, t)
+		}
+	}
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			// inside quotes, an unclosed quote runs to the end
+			switch words := Tokenize(part); len(words) {
+			case 0:
+			case 1:
+				addTerm(words[0])
+			default:
+				query.Phrases = append(query.Phrases, words)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			words := Tokenize(field)
+			if len(words) == 0 {
+				continue
+			}
+			last := len(words) - 1
+			for _, w := range words[:last] {
+				addTerm(w)
+			}
+			if !strings.HasSuffix(field, "*") {
+				addTerm(words[last])
+			} else if !seen["*"+words[last]] {
+				seen["*"+words[last]] = true
+				query.Prefixes = append(query.Prefixes, words[last])
+			}
+		}
+	}
+	return query
+}
+
+// Tokenize lower-cases text and splits it into words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// marks reports which of the lower-cased words the query matches: terms and
+// prefixes anywhere, phrase words only where the whole phrase occurs.
+func (q *Query) marks(words []string) []bool {
+	marked := make([]bool, len(words))
+	for i, w := range words {
+		for _, t := range q.Terms {
+			marked[i] = marked[i] || w == t
+		}
+		for _, p := range q.Prefixes {
+			marked[i] = marked[i] || strings.HasPrefix(w, p)
+		}
+	}
+	for _, phrase := range q.Phrases {
+	next:
+		for i := 0; i+len(phrase) <= len(words); i++ {
+			for j, t := range phrase {
+				if words[i+j] != t {
+					continue next
+				}
+			}
+			for j := range phrase {
+				marked[i+j] = true
+			}
+		}
+	}
+	return marked
+}
+
+// snippetWords is how many words a snippet shows around the first match.
+const snippetWords = 24
+
+// Snippet highlights the query in the first of the book's description,
+// title, author and genre that matches it. Without any match it shows the
+// start of the description.
+func Snippet(book *models.Book, q *Query) string {
+	fields := []string{book.Description, book.Title, book.Author, book.Genre}
+	for _, text := range fields {
+		if s, ok := highlight(text, q); ok {
+			return s
+		}
+	}
+	s, _ := highlight(book.Description, &Query{})
+	return s
+}
+
+// highlight cuts a window of text around its first match and marks the
+// matching words. ok is false when nothing in text matches.
+func highlight(text string, q *Query) (string, bool) {
+	type word struct{ start, end int }
+	var words []word
+	start := -1
+	for i, r := range text {
+		if isSeparator(r) {
+			if start >= 0 {
+				words = append(words, word{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start, len(text)})
+	}
+
+	if len(words) == 0 {
+		return "", false
+	}
+	lower := make([]string, len(words))
+	for i, w := range words {
+		lower[i] = strings.ToLower(text[w.start:w.end])
+	}
+	marked := q.marks(lower)
+	first := slices.Index(marked, true)
+	from := 0
+	if first > snippetWords/3 {
+		from = first - snippetWords/3
+	}
+	to := min(from+snippetWords, len(words))
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("… ")
+	}
+	pos := words[from].start
+	for i := from; i < to; i++ {
+		w := words[i]
+		sb.WriteString(html.EscapeString(text[pos:w.start]))
+		token := html.EscapeString(text[w.start:w.end])
+		if marked[i] {
+			sb.WriteString("<mark>" + token + "</mark>")
+		} else {
+			sb.WriteString(token)
+		}
+		pos = w.end
+	}
+	if to < len(words) {
+		sb.WriteString(" …")
+	} else {
+		sb.WriteString(html.EscapeString(text[pos:]))
+	}
+	return sb.String(), first >= 0
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want Query
+	}{
+		{"Dune Herbert", Query{Terms: []string{"dune", "herbert"}}},
+		{"dun*", Query{Prefixes: []string{"dun"}}},
+		{`"Science Fiction" dune`, Query{Terms: []string{"dune"}, Phrases: [][]string{{"science", "fiction"}}}},
+		{`dune "science fiction`, Query{Terms: []string{"dune"}, Phrases: [][]string{{"science", "fiction"}}}},
+		{`"dune"`, Query{Terms: []string{"dune"}}},
+		{`dune DUNE "dune" dun* dun*`, Query{Terms: []string{"dune"}, Prefixes: []string{"dun"}}},
+		{"o'brien +dune -(herbert)", Query{Terms: []string{"o", "brien", "dune", "herbert"}}},
+		{"sci-fi*", Query{Terms: []string{"sci"}, Prefixes: []string{"fi"}}},
+		{`* "" " " ***`, Query{}},
+		{"", Query{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			if got := ParseQuery(tt.q); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.q, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	var long []string
+	for i := range 40 {
+		long = append(long, "w"+strings.Repeat("x", i))
+	}
+	window := "… " + strings.Join(long[12:20], " ") + " <mark>" + long[20] + "</mark> " + strings.Join(long[21:36], " ") + " …"
+
+	tests := []struct {
+		name   string
+		text   string
+		q      string
+		want   string
+		wantOK bool
+	}{
+		{"term", "The Dune saga", "dune", "The <mark>Dune</mark> saga", true},
+		{"prefix", "Dune Messiah", "dun*", "<mark>Dune</mark> Messiah", true},
+		{"escapes HTML", `Tom & Jerry <b>"hi"</b>`, "jerry", "Tom &amp; <mark>Jerry</mark> &lt;b&gt;&#34;hi&#34;&lt;/b&gt;", true},
+		{"markup in the query is not reflected", "a <script> tag", "<script>", "a &lt;<mark>script</mark>&gt; tag", true},
+		{"phrase only where it occurs", "science and fiction, science fiction", `"science fiction"`,
+			"science and fiction, <mark>science</mark> <mark>fiction</mark>", true},
+		{"keeps trailing punctuation", "Dune!", "dune", "<mark>Dune</mark>!", true},
+		{"no match", "Plain & simple", "dune", "Plain &amp; simple", false},
+		{"window around the match", strings.Join(long, " "), long[20], window, true},
+		{"empty text", "", "dune", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := highlight(tt.text, ParseQuery(tt.q))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("highlight(%q, %q) = %q, %v; want %q, %v", tt.text, tt.q, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert", Description: "A desert planet & its spice."}
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"spice", "A desert planet &amp; its <mark>spice</mark>."},
+		{"dune", "<mark>Dune</mark>"},
+		{"herb*", "Frank <mark>Herbert</mark>"},
+		{"nothing", "A desert planet &amp; its spice."},
+	}
+	for _, tt := range tests {
+		if got := Snippet(book, ParseQuery(tt.q)); got != tt.want {
+			t.Errorf("Snippet(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestBooleanQuery(t *testing.T) {
+	got := booleanQuery(ParseQuery(`Dune herb* "science fiction" +(-x)`))
+	want := `+dune +x +herb* +"science fiction"`
+	if got != want {
+		t.Errorf("booleanQuery = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"log"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognise.
+const APIKeyPrefix = "bk_"
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid, expired or revoked api key")
+	ErrAPIKeyNameEmpty = errors.New("api key name is required")
+	ErrAPIKeyExpiry    = errors.New("api key expiry must be in the future")
+)
+
+// APIKeyService creates, lists, revokes and authenticates personal API keys.
+type APIKeyService struct {
+	Repo  *repo.APIKeyRepo
+	Users *repo.UserRepo
+}
+
+func NewAPIKeyService(r *repo.APIKeyRepo, users *repo.UserRepo) *APIKeyService {
+	return &APIKeyService{Repo: r, Users: users}
+}
+
+// CreateAPIKey issues a key for user and returns it with its record. The
+// full key is only ever returned here. The key gets the requested scopes, or
+// every scope of the user's role when none are requested.
+func (s *APIKeyService) CreateAPIKey(user *models.User, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrAPIKeyNameEmpty
+	}
+	granted, err := ResolveScopes(user.Role, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrAPIKeyExpiry
+	}
+	id, err := utils.RandomToken(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix := APIKeyPrefix + id
+	key := prefix + "_" + secret
+	record := models.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(key),
+		Scopes:    strings.Join(granted, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.Repo.CreateAPIKey(&record); err != nil {
+		return "", nil, err
+	}
+	return key, &record, nil
+}
+
+func (s *APIKeyService) GetAPIKeysByUser(userID int) ([]models.APIKey, error) {
+	return s.Repo.GetAPIKeysByUser(userID)
+}
+
+func (s *APIKeyService) RevokeAPIKey(id int, userID int) error {
+	return s.Repo.RevokeAPIKey(id, userID)
+}
+
+// Authenticate resolves a full API key to its record and owner. Unknown,
+// expired and revoked keys all yield ErrInvalidAPIKey.
+func (s *APIKeyService) Authenticate(key string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	record, err := s.Repo.GetAPIKeyByHash(utils.HashToken(key))
+	if errors.Is(err, repo.ErrAPIKeyNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	user, err := s.Users.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.Repo.TouchAPIKey(record.ID, now); err != nil {
+			log.Printf("could not record use of api key %d: %v", record.ID, err)
+		}
+	}
+	return record, user, nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+)
+
+// MaxAuditEntries caps how many audit entries one listing returns.
+const MaxAuditEntries = 500
+
+type AuditService struct {
+	Repo *repo.AuditRepo
+}
+
+func NewAuditService(r *repo.AuditRepo) *AuditService {
+	return &AuditService{Repo: r}
+}
+
+func (s *AuditService) Record(entry *models.AuditLog) error {
+	return s.Repo.CreateEntry(entry)
+}
+
+// GetEntries returns the newest entries, optionally only those of one admin.
+func (s *AuditService) GetEntries(actorID int, limit int) ([]models.AuditLog, error) {
+	if limit <= 0 || limit > MaxAuditEntries {
+		limit = MaxAuditEntries
+	}
+	return s.Repo.GetEntries(actorID, limit)
+}
@@ -1,33 +1,355 @@
 package services
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"first_task/go-fiber-api/internal/models"
 	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/search"
+	"log"
+	"strings"
+	"time"
 )
 
-func NewBookService(r *repo.BookRepo) *BookService {
-	return &BookService{Repo: r}
+var (
+	ErrBalanceOverLimit     = errors.New("outstanding balance too high to check out")
+	ErrBookTitleEmpty       = errors.New("title cannot be empty")
+	ErrBookQuantityNegative = errors.New("quantity cannot be negative")
+)
+
+// Page sizes of ListBooks.
+const (
+	DefaultBookPageSize = 20
+	MaxBookPageSize     = 100
+)
+
+var (
+	ErrInvalidBookSort   = errors.New("sort must be title, published_year or quantity, optionally prefixed with -")
+	ErrInvalidBookCursor = errors.New("invalid cursor")
+)
+
+// sortable book columns; id is the default order
+var bookSorts = map[string]bool{"title": true, "published_year": true, "quantity": true}
+
+// BookListParams are the query parameters of a book listing. Zero values
+// leave filters off.
+type BookListParams struct {
+	Search         string
+	Genre          string
+	PublisherID    int
+	YearFrom       int
+	YearTo         int
+	Available      bool
+	IncludeDeleted bool
+	Sort           string // "title", "-published_year", ...
+	Limit          int
+	Page           int    // 1-based; 0 pages by cursor
+	Cursor         string // next_cursor of the previous page
+}
+
+// BookPage is one page of a book listing.
+type BookPage struct {
+	Books      []models.Book `json:"books"`
+	Total      int64         `json:"total"` // matching books across all pages
+	Limit      int           `json:"limit"`
+	Page       int           `json:"page,omitempty"`
+	NextPage   int           `json:"next_page,omitempty"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// bookCursor is the JSON inside a cursor. Sort ties it to one ordering, so
+// it cannot be replayed against another.
+type bookCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v,omitempty"`
+	ID    int             `json:"id"`
+}
+
+func encodeBookCursor(sort, column string, last *models.Book) (string, error) {
+	var value any
+	switch column {
+	case "title":
+		value = last.Title
+	case "published_year":
+		value = last.PublishedYear
+	case "quantity":
+		value = last.Quantity
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(bookCursor{Sort: sort, Value: raw, ID: last.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeBookCursor(cursor, sort string) (*repo.BookCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidBookCursor
+	}
+	var c bookCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || c.ID <= 0 {
+		return nil, ErrInvalidBookCursor
+	}
+	after := &repo.BookCursor{ID: c.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case "title":
+		var title string
+		err = json.Unmarshal(c.Value, &title)
+		after.Value = title
+	case "published_year", "quantity":
+		var n int
+		err = json.Unmarshal(c.Value, &n)
+		after.Value = n
+	}
+	if err != nil {
+		return nil, ErrInvalidBookCursor
+	}
+	return after, nil
+}
+
+// BookUpdate is a partial update of a book: fields left nil keep their value.
+type BookUpdate struct {
+	Title         *string `json:"title"`
+	Author        *string `json:"author"`
+	PublishedYear *int    `json:"published_year"`
+	Quantity      *int    `json:"quantity"`
+	Genre         *string `json:"genre"`
+	Description   *string `json:"description"`
+	ImgURL        *string `json:"img_url"`
+	PublisherID   *int    `json:"publisher_id"`
+}
+
+// Result sizes of SearchBooks.
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 50
+)
+
+var ErrSearchQueryEmpty = errors.New("search query cannot be empty")
+
+// BookSearchResult is a book found by SearchBooks. Snippet is HTML: the
+// matching passage, escaped, with the matched words in <mark>.
+type BookSearchResult struct {
+	Book    models.Book `json:"book"`
+	Score   float64     `json:"score"`
+	Snippet string      `json:"snippet"`
+}
+
+func NewBookService(r *repo.BookRepo, ledger *repo.LedgerRepo, policy LoanPolicy, searcher search.Searcher) *BookService {
+	return &BookService{Repo: r, Ledger: ledger, Policy: policy, Search: searcher}
 }
 
 type BookService struct {
-	Repo *repo.BookRepo
+	Repo   *repo.BookRepo
+	Ledger *repo.LedgerRepo
+	Policy LoanPolicy
+	Search search.Searcher
 }
 
 func (s *BookService) CreateBook(book *models.Book) error {
-	return s.Repo.CreateBook(book)
+	if err := s.Repo.CreateBook(book); err != nil {
+		return err
+	}
+	s.reindex(book)
+	return nil
+}
+
+// SearchBooks returns up to limit books matching q, most relevant first.
+// Words, "quoted phrases" and prefix* words all have to match.
+func (s *BookService) SearchBooks(q string, limit int) ([]BookSearchResult, error) {
+	if search.ParseQuery(q).Empty() {
+		return nil, ErrSearchQueryEmpty
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	hits, err := s.Search.Search(q, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.BookID
+	}
+	books, err := s.Repo.GetBooksByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	// keep the ranking; books deleted since they were indexed drop out
+	results := make([]BookSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		if book, ok := byID[hit.BookID]; ok {
+			results = append(results, BookSearchResult{Book: book, Score: hit.Score, Snippet: hit.Snippet})
+		}
+	}
+	return results, nil
+}
+
+// reindex updates the search index after a change. The change is already
+// saved, so a failure is only logged.
+func (s *BookService) reindex(book *models.Book) {
+	if err := s.Search.Index(book); err != nil {
+		log.Printf("search: could not index book %d: %v", book.ID, err)
+	}
 }
-func (s *BookService) GetAllBooksFiltered(search string) ([]models.Book, error) {
-	return s.Repo.GetAllBooks(search)
+
+// ListBooks returns one page of books. Pages are addressed by an opaque
+// cursor by default, or by number when params.Page is set; NextCursor is set
+// in both modes while more books follow.
+func (s *BookService) ListBooks(params BookListParams) (*BookPage, error) {
+	filter := repo.BookFilter{
+		Search:         params.Search,
+		Genre:          params.Genre,
+		PublisherID:    params.PublisherID,
+		YearFrom:       params.YearFrom,
+		YearTo:         params.YearTo,
+		Available:      params.Available,
+		IncludeDeleted: params.IncludeDeleted,
+		SortBy:         "id",
+	}
+	if params.Sort != "" {
+		filter.SortBy, filter.Desc = strings.CutPrefix(params.Sort, "-")
+		if !bookSorts[filter.SortBy] {
+			return nil, ErrInvalidBookSort
+		}
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultBookPageSize
+	}
+	if limit > MaxBookPageSize {
+		limit = MaxBookPageSize
+	}
+	if params.Page < 0 || (params.Page > 0 && params.Cursor != "") {
+		return nil, ErrInvalidBookCursor
+	}
+	if params.Cursor != "" {
+		after, err := decodeBookCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+	if params.Page > 0 {
+		filter.Offset = (params.Page - 1) * limit
+	}
+	// one extra row tells whether another page follows
+	filter.Limit = limit + 1
+
+	books, total, err := s.Repo.GetBooks(filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &BookPage{Books: books, Total: total, Limit: limit, Page: params.Page}
+	if len(books) > limit {
+		page.Books = books[:limit]
+		last := page.Books[limit-1]
+		if page.NextCursor, err = encodeBookCursor(params.Sort, filter.SortBy, &last); err != nil {
+			return nil, err
+		}
+		if params.Page > 0 {
+			page.NextPage = params.Page + 1
+		}
+	}
+	return page, nil
 }
 
 func (s *BookService) GetBookByID(id int) (*models.Book, error) {
 	return s.Repo.GetBookByID(id)
 }
 
-func (s *BookService) Checkin(id int) error {
-	return s.Repo.Checkin(id)
+// UpdateBook applies update to the book and returns the updated book.
+func (s *BookService) UpdateBook(id int, update *BookUpdate) (*models.Book, error) {
+	fields := map[string]any{}
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" {
+			return nil, ErrBookTitleEmpty
+		}
+		fields["title"] = title
+	}
+	if update.Author != nil {
+		fields["author"] = strings.TrimSpace(*update.Author)
+	}
+	if update.PublishedYear != nil {
+		fields["published_year"] = *update.PublishedYear
+	}
+	if update.Quantity != nil {
+		if *update.Quantity < 0 {
+			return nil, ErrBookQuantityNegative
+		}
+		fields["quantity"] = *update.Quantity
+	}
+	if update.Genre != nil {
+		fields["genre"] = *update.Genre
+	}
+	if update.Description != nil {
+		fields["description"] = *update.Description
+	}
+	if update.ImgURL != nil {
+		fields["img_url"] = *update.ImgURL
+	}
+	if update.PublisherID != nil {
+		fields["publisher_id"] = *update.PublisherID
+	}
+	if err := s.Repo.UpdateBook(id, fields); err != nil {
+		return nil, err
+	}
+	book, err := s.Repo.GetBookByID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.reindex(book)
+	return book, nil
+}
+
+func (s *BookService) DeleteBook(id int) error {
+	if err := s.Repo.DeleteBook(id); err != nil {
+		return err
+	}
+	if err := s.Search.Remove(id); err != nil {
+		log.Printf("search: could not remove book %d: %v", id, err)
+	}
+	return nil
+}
+
+func (s *BookService) RestoreBook(id int) error {
+	if err := s.Repo.RestoreBook(id); err != nil {
+		return err
+	}
+	book, err := s.Repo.GetBookByID(id)
+	if err != nil {
+		return err
+	}
+	s.reindex(book)
+	return nil
+}
+
+func (s *BookService) Checkin(id int, userID int) error {
+	return s.Repo.Checkin(id, userID, s.Policy.HoldExpiry(time.Now()), s.Policy.LateFine)
 }
 
-func (s *BookService) Checkout(id int) error {
-	return s.Repo.Checkout(id)
+// Checkout refuses users whose unpaid fines exceed Policy.BalanceBlockCents.
+func (s *BookService) Checkout(id int, userID int) error {
+	balance, err := s.Ledger.GetBalance(userID)
+	if err != nil {
+		return err
+	}
+	if balance > s.Policy.BalanceBlockCents {
+		return ErrBalanceOverLimit
+	}
+	return s.Repo.Checkout(id, userID, s.Policy.DueDate(time.Now()))
 }
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+func TestBookCursorRoundTrip(t *testing.T) {
+	last := &models.Book{ID: 42, Title: "Dune", PublishedYear: 1965, Quantity: 3}
+	tests := []struct {
+		sort, column string
+		want         any
+	}{
+		{"", "id", nil},
+		{"title", "title", "Dune"},
+		{"-title", "title", "Dune"},
+		{"published_year", "published_year", 1965},
+		{"-quantity", "quantity", 3},
+	}
+	for _, tt := range tests {
+		t.Run("sort="+tt.sort, func(t *testing.T) {
+			cursor, err := encodeBookCursor(tt.sort, tt.column, last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := decodeBookCursor(cursor, tt.sort)
+			if err != nil {
+				t.Fatalf("decodeBookCursor: %v", err)
+			}
+			if after.ID != 42 || after.Value != tt.want {
+				t.Errorf("decoded %+v, want ID 42 and value %v", after, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookCursorRejected(t *testing.T) {
+	titleCursor, err := encodeBookCursor("title", "title", &models.Book{ID: 7, Title: "Emma"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name, cursor, sort string
+	}{
+		{"other sort", titleCursor, "published_year"},
+		{"other direction", titleCursor, "-title"},
+		{"default sort", titleCursor, ""},
+		{"not base64", "%%%", "title"},
+		{"padded base64", titleCursor + "=", "title"},
+		{"not JSON", raw("dune"), "title"},
+		{"missing ID", raw(`{"s":"title","v":"Emma"}`), "title"},
+		{"negative ID", raw(`{"s":"title","v":"Emma","id":-1}`), "title"},
+		{"number for a title", raw(`{"s":"title","v":5,"id":7}`), "title"},
+		{"string for a year", raw(`{"s":"published_year","v":"1999","id":7}`), "published_year"},
+		{"object for a quantity", raw(`{"s":"quantity","v":{},"id":7}`), "quantity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeBookCursor(tt.cursor, tt.sort); !errors.Is(err, ErrInvalidBookCursor) {
+				t.Errorf("decodeBookCursor = %v, want ErrInvalidBookCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	"log"
+	"time"
+)
+
+type HoldService struct {
+	Repo   *repo.HoldRepo
+	Policy LoanPolicy
+}
+
+func NewHoldService(r *repo.HoldRepo, policy LoanPolicy) *HoldService {
+	return &HoldService{Repo: r, Policy: policy}
+}
+
+func (s *HoldService) CreateHold(bookID int, userID int) (*models.Hold, error) {
+	return s.Repo.CreateHold(bookID, userID)
+}
+
+func (s *HoldService) GetHoldsByBook(bookID int) ([]models.Hold, error) {
+	return s.Repo.GetHoldsByBook(bookID)
+}
+
+func (s *HoldService) GetHoldsByUser(userID int) ([]models.Hold, error) {
+	return s.Repo.GetHoldsByUser(userID)
+}
+
+func (s *HoldService) CancelHold(id int, userID int) error {
+	return s.Repo.CancelHold(id, userID, s.Policy.HoldExpiry(time.Now()))
+}
+
+// RunExpirySweeper expires ready holds whose pickup window has passed and
+// passes their copies on. It blocks, so start it in its own goroutine.
+func (s *HoldService) RunExpirySweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := time.Now(); ; now = <-ticker.C {
+		n, err := s.Repo.ExpireHolds(now, s.Policy.HoldExpiry(now))
+		if err != nil {
+			log.Printf("hold sweeper: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("hold sweeper: expired %d hold(s)", n)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is a public key as published in the JWKS document (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+	jwk    JWK
+}
+
+// KeySet signs access tokens with one key and verifies them against every
+// active key, looked up by the token's "kid" header. During a rotation the
+// previous key stays in the set until the tokens it signed have expired.
+//
+// A KeySet built from a shared secret (HS256) keeps the old behaviour and
+// publishes no keys.
+type KeySet struct {
+	method     jwt.SigningMethod
+	signingKey any
+	signingKID string
+	keys       map[string]verificationKey
+}
+
+// NewHMACKeySet returns a KeySet that signs and verifies with an HS256 secret.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{method: jwt.SigningMethodHS256, signingKey: []byte(secret)}
+}
+
+// LoadKeySet reads a PKCS#8 PEM private key (Ed25519 or RSA) to sign with and
+// PKIX PEM public keys of retired signing keys that should still verify.
+func LoadKeySet(signingKeyFile string, verifyKeyFiles []string) (*KeySet, error) {
+	data, err := os.ReadFile(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", signingKeyFile)
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", signingKeyFile, priv)
+	}
+
+	ks := &KeySet{signingKey: priv, keys: map[string]verificationKey{}}
+	vk, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+	ks.method = vk.method
+	ks.signingKID = vk.jwk.Kid
+	ks.keys[vk.jwk.Kid] = vk
+
+	for _, file := range verifyKeyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM data", file)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		vk, err := newVerificationKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ks.keys[vk.jwk.Kid] = vk
+	}
+	return ks, nil
+}
+
+// newVerificationKey describes pub as a JWK whose kid is its RFC 7638 thumbprint.
+func newVerificationKey(pub crypto.PublicKey) (verificationKey, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	var (
+		vk         verificationKey
+		thumbprint []byte
+		err        error
+	)
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		vk = verificationKey{method: jwt.SigningMethodEdDSA, key: k,
+			jwk: JWK{Kty: "OKP", Crv: "Ed25519", X: b64(k), Use: "sig", Alg: "EdDSA"}}
+		// members in lexicographic order, as the thumbprint requires
+		thumbprint, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", "OKP", vk.jwk.X})
+	case *rsa.PublicKey:
+		vk = verificationKey{method: jwt.SigningMethodRS256, key: k,
+			jwk: JWK{Kty: "RSA", N: b64(k.N.Bytes()), E: b64(big.NewInt(int64(k.E)).Bytes()), Use: "sig", Alg: "RS256"}}
+		thumbprint, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{vk.jwk.E, "RSA", vk.jwk.N})
+	default:
+		return vk, fmt.Errorf("unsupported key type %T, use Ed25519 or RSA", pub)
+	}
+	if err != nil {
+		return vk, err
+	}
+	sum := sha256.Sum256(thumbprint)
+	vk.jwk.Kid = b64(sum[:])
+	return vk, nil
+}
+
+// Sign signs claims with the current signing key, naming it in the "kid" header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.method, claims)
+	if ks.signingKID != "" {
+		token.Header["kid"] = ks.signingKID
+	}
+	return token.SignedString(ks.signingKey)
+}
+
+// Keyfunc returns the key that verifies token, refusing unknown kids and any
+// algorithm other than the one that key was published for.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	if ks.keys == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.signingKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	vk, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return vk.key, nil
+}
+
+// JWKS returns the public verification keys, the signing key first.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if vk, ok := ks.keys[ks.signingKID]; ok {
+		set.Keys = append(set.Keys, vk.jwk)
+	}
+	for kid, vk := range ks.keys {
+		if kid != ks.signingKID {
+			set.Keys = append(set.Keys, vk.jwk)
+		}
+	}
+	return set
+}
+
+// Alg returns the JWS algorithm tokens are signed with.
+func (ks *KeySet) Alg() string {
+	return ks.method.Alg()
+}
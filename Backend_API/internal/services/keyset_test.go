@@ -0,0 +1,214 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey writes priv as a PKCS#8 PEM file and its public half as a PKIX
+// PEM file, returning both paths.
+func writeKey(t *testing.T, name string, priv any, pub any) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privFile := filepath.Join(dir, name+".pem")
+	pubFile := filepath.Join(dir, name+".pub")
+	if err := os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return privFile, pubFile
+}
+
+func newEd25519Files(t *testing.T, name string) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeKey(t, name, priv, pub)
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestKeySetSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile, _ := writeKey(t, "rsa", rsaKey, &rsaKey.PublicKey)
+	edFile, _ := newEd25519Files(t, "ed")
+
+	for _, tt := range []struct {
+		file string
+		alg  string
+	}{{edFile, "EdDSA"}, {rsaFile, "RS256"}} {
+		t.Run(tt.alg, func(t *testing.T) {
+			ks, err := LoadKeySet(tt.file, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ks.Alg() != tt.alg {
+				t.Errorf("Alg() = %s, want %s", ks.Alg(), tt.alg)
+			}
+			signed, err := ks.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := jwt.Parse(signed, ks.Keyfunc)
+			if err != nil {
+				t.Fatalf("own token rejected: %v", err)
+			}
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || token.Header["kid"] != jwks.Keys[0].Kid || jwks.Keys[0].Alg != tt.alg {
+				t.Errorf("kid %v does not match the published key %+v", token.Header["kid"], jwks.Keys)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldFile, oldPub := newEd25519Files(t, "old")
+	newFile, _ := newEd25519Files(t, "new")
+	oldKS, err := LoadKeySet(oldFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := oldKS.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := LoadKeySet(newFile, []string{oldPub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(signed, rotated.Keyfunc); err != nil {
+		t.Errorf("token of the retired key rejected during rotation: %v", err)
+	}
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != rotated.signingKID {
+		t.Errorf("JWKS should list the signing key first, then the retired one: %+v", jwks.Keys)
+	}
+
+	retired, err := LoadKeySet(newFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(signed, retired.Keyfunc); err == nil {
+		t.Error("token of a removed key still verifies")
+	}
+}
+
+func TestKeySetKeyfuncRejects(t *testing.T) {
+	edFile, edPub := newEd25519Files(t, "ed")
+	ks, err := LoadKeySet(edFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := os.ReadFile(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid any, key any) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// HS256 keyed with the public key, which anyone can fetch from the JWKS
+		{"HMAC with the public key", sign(jwt.SigningMethodHS256, ks.signingKID, pubPEM)},
+		{"unsigned", sign(jwt.SigningMethodNone, ks.signingKID, jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown kid", sign(jwt.SigningMethodEdDSA, "someone-else", otherPriv)},
+		{"missing kid", sign(jwt.SigningMethodEdDSA, nil, otherPriv)},
+		{"known kid, wrong key", sign(jwt.SigningMethodEdDSA, ks.signingKID, otherPriv)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwt.Parse(tt.token, ks.Keyfunc); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestHMACKeySet(t *testing.T) {
+	ks := NewHMACKeySet("secret")
+	signed, err := ks.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(signed, ks.Keyfunc); err != nil {
+		t.Errorf("own token rejected: %v", err)
+	}
+	if len(ks.JWKS().Keys) != 0 {
+		t.Error("an HMAC key set must not publish keys")
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims()).SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(other, ks.Keyfunc); err == nil {
+		t.Error("EdDSA token accepted by an HMAC key set")
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("guess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(forged, ks.Keyfunc); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+}
+
+func TestLoadKeySetInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeySet(garbage, nil); err == nil {
+		t.Error("LoadKeySet accepted a file without PEM data")
+	}
+	if _, err := LoadKeySet(filepath.Join(dir, "missing.pem"), nil); err == nil {
+		t.Error("LoadKeySet accepted a missing file")
+	}
+}
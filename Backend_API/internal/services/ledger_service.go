@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+)
+
+var ErrInvalidPayment = errors.New("amount must be positive and kind must be payment or waiver")
+
+type LedgerService struct {
+	Repo *repo.LedgerRepo
+}
+
+func NewLedgerService(r *repo.LedgerRepo) *LedgerService {
+	return &LedgerService{Repo: r}
+}
+
+// GetBalance returns the user's balance in cents along with the ledger entries behind it.
+func (s *LedgerService) GetBalance(userID int) (int, []models.LedgerEntry, error) {
+	balance, err := s.Repo.GetBalance(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, err := s.Repo.GetEntriesByUser(userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return balance, entries, nil
+}
+
+// RecordPayment credits the user's account with a payment or a waiver of amountCents.
+func (s *LedgerService) RecordPayment(userID int, kind string, amountCents int, note string, recordedBy int) (*models.LedgerEntry, error) {
+	if amountCents <= 0 || (kind != models.LedgerPayment && kind != models.LedgerWaiver) {
+		return nil, ErrInvalidPayment
+	}
+	entry := models.LedgerEntry{
+		UserID:      userID,
+		Kind:        kind,
+		AmountCents: -amountCents,
+		Note:        note,
+		RecordedBy:  &recordedBy,
+	}
+	if err := s.Repo.CreateEntry(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	"log"
+	"time"
+)
+
+// LoanPolicy holds the circulation rules applied to checkouts, renewals and holds.
+type LoanPolicy struct {
+	LoanPeriod  time.Duration
+	MaxRenewals int
+	HoldPeriod  time.Duration // how long a returned copy stays reserved for a ready hold
+
+	FinePerDayCents   int // charged for each started day a loan is returned late
+	FineCapCents      int // maximum fine per loan, 0 for no cap
+	BalanceBlockCents int // checkouts are refused while the balance is above this
+}
+
+// DueDate returns when a loan starting at from must be returned.
+func (p LoanPolicy) DueDate(from time.Time) time.Time {
+	return from.Add(p.LoanPeriod)
+}
+
+// LateFine returns the fine in cents for a returned loan, 0 if it came back on time.
+func (p LoanPolicy) LateFine(loan *models.Loan) int {
+	if loan.DueAt == nil || loan.ReturnedAt == nil || !loan.ReturnedAt.After(*loan.DueAt) {
+		return 0
+	}
+	late := loan.ReturnedAt.Sub(*loan.DueAt)
+	days := int((late + 24*time.Hour - 1) / (24 * time.Hour))
+	fine := days * p.FinePerDayCents
+	if p.FineCapCents > 0 && fine > p.FineCapCents {
+		fine = p.FineCapCents
+	}
+	return fine
+}
+
+// HoldExpiry returns when a hold that becomes ready at from stops being reserved.
+func (p LoanPolicy) HoldExpiry(from time.Time) time.Time {
+	return from.Add(p.HoldPeriod)
+}
+
+type LoanService struct {
+	Repo   *repo.LoanRepo
+	Policy LoanPolicy
+}
+
+func NewLoanService(r *repo.LoanRepo, policy LoanPolicy) *LoanService {
+	return &LoanService{Repo: r, Policy: policy}
+}
+
+func (s *LoanService) GetLoansByBook(bookID int) ([]models.Loan, error) {
+	return s.Repo.GetLoansByBook(bookID)
+}
+
+func (s *LoanService) GetLoansByUser(userID int) ([]models.Loan, error) {
+	return s.Repo.GetLoansByUser(userID)
+}
+
+func (s *LoanService) GetOverdueLoans() ([]models.Loan, error) {
+	return s.Repo.GetOverdueLoans(time.Now())
+}
+
+// RenewLoan extends the borrower's loan by one loan period, up to Policy.MaxRenewals times.
+func (s *LoanService) RenewLoan(id int, userID int) (*models.Loan, error) {
+	return s.Repo.RenewLoan(id, userID, s.Policy.MaxRenewals, s.Policy.LoanPeriod)
+}
+
+// RunOverdueSweeper flags loans as overdue once their due date passes.
+// It blocks, so start it in its own goroutine.
+func (s *LoanService) RunOverdueSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := time.Now(); ; now = <-ticker.C {
+		n, err := s.Repo.MarkOverdue(now)
+		if err != nil {
+			log.Printf("overdue sweeper: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("overdue sweeper: marked %d loan(s) overdue", n)
+		}
+	}
+}
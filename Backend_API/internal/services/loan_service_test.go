@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"first_task/go-fiber-api/internal/models"
+)
+
+func TestLateFine(t *testing.T) {
+	due := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	policy := LoanPolicy{FinePerDayCents: 25, FineCapCents: 1000}
+
+	tests := []struct {
+		name     string
+		policy   LoanPolicy
+		due      *time.Time
+		returned time.Duration // after due
+		open     bool
+		want     int
+	}{
+		{"returned early", policy, &due, -day, false, 0},
+		{"returned exactly on time", policy, &due, 0, false, 0},
+		{"one second late counts a day", policy, &due, time.Second, false, 25},
+		{"exactly one day late", policy, &due, day, false, 25},
+		{"just over one day late", policy, &due, day + time.Second, false, 50},
+		{"ten days late", policy, &due, 10 * day, false, 250},
+		{"capped", policy, &due, 100 * day, false, 1000},
+		{"no cap", LoanPolicy{FinePerDayCents: 25}, &due, 100 * day, false, 2500},
+		{"no due date", policy, nil, 10 * day, false, 0},
+		{"still on loan", policy, &due, 10 * day, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := &models.Loan{DueAt: tt.due}
+			if !tt.open {
+				returned := due.Add(tt.returned)
+				loan.ReturnedAt = &returned
+			}
+			if got := tt.policy.LateFine(loan); got != tt.want {
+				t.Errorf("LateFine() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
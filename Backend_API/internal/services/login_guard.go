@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCredentials is the single answer to a wrong email or a wrong
+// password, so a login attempt does not reveal which accounts exist.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LoginLockedError is returned while an account or client IP is locked out
+// after too many failed logins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// LockoutPolicy decides when failed logins lock an account or a client IP.
+// Once MaxAttempts is reached every further failure locks for Lockout,
+// doubled per extra failure up to MaxLockout.
+type LockoutPolicy struct {
+	MaxAttempts   int // per account
+	IPMaxAttempts int // per client IP, across all accounts
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+}
+
+// lockoutFor returns how long the nth consecutive failure locks for, 0 below limit.
+func (p LockoutPolicy) lockoutFor(failures int, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	d := p.Lockout
+	for i := limit; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+type attempts struct {
+	failures    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// LoginGuard tracks failed logins per account (in the users table) and per
+// client IP (in memory) and locks either out with exponential backoff.
+// Emails without an account are tracked in memory and lock like accounts, so
+// a lockout does not tell whether an address is registered.
+type LoginGuard struct {
+	Users  *repo.UserRepo
+	Policy LockoutPolicy
+
+	mu      sync.Mutex
+	ips     map[string]*attempts
+	unknown map[string]*attempts // by normalized email
+}
+
+func NewLoginGuard(users *repo.UserRepo, policy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{Users: users, Policy: policy, ips: map[string]*attempts{}, unknown: map[string]*attempts{}}
+}
+
+// wait returns how much longer key is locked out in table.
+func (g *LoginGuard) wait(table map[string]*attempts, key string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a := table[key]; a != nil {
+		return a.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failure for key in table, locking it once limit is reached.
+func (g *LoginGuard) fail(table map[string]*attempts, key string, limit int, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	a := table[key]
+	if a == nil {
+		a = &attempts{}
+		table[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	if d := g.Policy.lockoutFor(a.failures, limit); d > 0 {
+		a.lockedUntil = now.Add(d)
+	}
+}
+
+// Check returns a *LoginLockedError when ip, or user when it is not nil, is
+// currently locked out.
+func (g *LoginGuard) Check(ip string, user *models.User) error {
+	now := time.Now()
+	if wait := g.wait(g.ips, ip, now); wait > 0 {
+		return &LoginLockedError{RetryAfter: wait}
+	}
+	if user != nil && user.LockedUntil != nil {
+		if wait := user.LockedUntil.Sub(now); wait > 0 {
+			return &LoginLockedError{RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// CheckUnknown returns a *LoginLockedError while an email that belongs to no
+// account is locked out.
+func (g *LoginGuard) CheckUnknown(email string) error {
+	if wait := g.wait(g.unknown, utils.NormalizeEmail(email), time.Now()); wait > 0 {
+		return &LoginLockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordUnknownFailure counts a failed login from ip for an email that belongs
+// to no account, with the same limits as an account.
+func (g *LoginGuard) RecordUnknownFailure(ip string, email string) {
+	now := time.Now()
+	g.fail(g.ips, ip, g.Policy.IPMaxAttempts, now)
+	g.fail(g.unknown, utils.NormalizeEmail(email), g.Policy.MaxAttempts, now)
+}
+
+// RecordFailure counts a failed login from ip against user.
+func (g *LoginGuard) RecordFailure(ip string, user *models.User) {
+	now := time.Now()
+	g.fail(g.ips, ip, g.Policy.IPMaxAttempts, now)
+
+	_, err := g.Users.RecordFailedLogin(user.ID, func(failures int) *time.Time {
+		d := g.Policy.lockoutFor(failures, g.Policy.MaxAttempts)
+		if d == 0 {
+			return nil
+		}
+		until := now.Add(d)
+		return &until
+	})
+	if err != nil {
+		log.Printf("could not record failed login for user %d: %v", user.ID, err)
+	}
+}
+
+// RecordSuccess clears the failure counters of ip and user after a login.
+func (g *LoginGuard) RecordSuccess(ip string, user *models.User) error {
+	g.mu.Lock()
+	delete(g.ips, ip)
+	g.mu.Unlock()
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return g.Users.ResetFailedLogins(user.ID)
+}
+
+// Unlock lifts an account's lockout and resets its failure count.
+func (g *LoginGuard) Unlock(userID int) error {
+	return g.Users.ResetFailedLogins(userID)
+}
+
+// RunSweeper forgets client IPs and unknown emails that have not failed a
+// login for a while, so the in-memory tables do not grow without bound. It
+// blocks, so start it in its own goroutine.
+func (g *LoginGuard) RunSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		g.mu.Lock()
+		for _, table := range []map[string]*attempts{g.ips, g.unknown} {
+			for key, a := range table {
+				if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > g.Policy.MaxLockout {
+					delete(table, key)
+				}
+			}
+		}
+		g.mu.Unlock()
+	}
+}
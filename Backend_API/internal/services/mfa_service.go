@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes each enrollment hands out.
+const RecoveryCodeCount = 10
+
+var (
+	ErrMFANotEnrolled  = errors.New("two-factor authentication has not been set up")
+	ErrMFAAlreadyOn    = errors.New("two-factor authentication already enabled")
+	ErrInvalidMFACode  = errors.New("invalid two-factor code")
+	ErrMFANotRequested = errors.New("two-factor authentication is not enabled for this user")
+	ErrWrongPassword   = errors.New("current password is incorrect")
+)
+
+// MFAService handles TOTP enrollment and the second login step.
+type MFAService struct {
+	Users  *repo.UserRepo
+	Repo   *repo.MFARepo
+	Issuer string // shown as the account's label in authenticator apps
+}
+
+func NewMFAService(users *repo.UserRepo, r *repo.MFARepo, issuer string) *MFAService {
+	return &MFAService{Users: users, Repo: r, Issuer: issuer}
+}
+
+// Enroll checks the user's current password and creates a TOTP secret and a
+// fresh set of recovery codes. Two-factor login stays off until Confirm
+// receives a valid code, so calling Enroll again before that simply starts
+// over. Replacing a confirmed authenticator also takes a current code from
+// it (or a recovery code); two-factor login is then off until the new one
+// is confirmed.
+func (s *MFAService) Enroll(userID int, password, code string) (string, []string, error) {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !utils.CheckPassword(user.Password, password) {
+		return "", nil, ErrWrongPassword
+	}
+	if user.TOTPEnabled {
+		if strings.TrimSpace(code) == "" {
+			return "", nil, ErrMFAAlreadyOn
+		}
+		if err := s.Verify(userID, code); err != nil {
+			return "", nil, err
+		}
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return "", nil, err
+		}
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := s.Repo.StartEnrollment(userID, secret, hashes, user.TOTPEnabled); err != nil {
+		if errors.Is(err, repo.ErrTOTPAlreadyEnabled) {
+			return "", nil, ErrMFAAlreadyOn
+		}
+		return "", nil, err
+	}
+	return utils.TOTPURI(s.Issuer, user.Email, secret), codes, nil
+}
+
+// Confirm enables two-factor login once the user proves their authenticator
+// produces valid codes.
+func (s *MFAService) Confirm(userID int, code string) error {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return ErrMFAAlreadyOn
+	}
+	if user.TOTPSecret == "" {
+		return ErrMFANotEnrolled
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return s.Repo.EnableTOTP(userID, step)
+}
+
+// Reset turns off two-factor login for a user who lost their authenticator
+// and recovery codes, so they can log in with their password and enroll again.
+func (s *MFAService) Reset(userID int) error {
+	return s.Repo.ResetTOTP(userID)
+}
+
+// Verify checks the second factor of a login: a current TOTP code, or one of
+// the user's unused recovery codes. Each code is accepted only once.
+func (s *MFAService) Verify(userID int, code string) error {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotRequested
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == utils.TOTPDigits {
+		step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		if err := s.Repo.UseTOTPStep(userID, step); err != nil {
+			if errors.Is(err, repo.ErrTOTPStepUsed) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return nil
+	}
+	err = s.Repo.ConsumeRecoveryCode(userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repo.ErrRecoveryCodeInvalid) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+// newRecoveryCode returns a code like "k3m9q-x7p2w".
+func newRecoveryCode() (string, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secret[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed loosely.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
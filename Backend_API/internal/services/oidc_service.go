@@ -0,0 +1,317 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthCodeTTL is how long a client has to exchange an authorization code.
+const AuthCodeTTL = 2 * time.Minute
+
+// OAuthClientPrefix starts every client ID.
+const OAuthClientPrefix = "oc_"
+
+var (
+	ErrOAuthClientNameEmpty = errors.New("client name is required")
+	ErrInvalidRedirectURI   = errors.New("redirect_uris must be absolute http(s) URLs without a fragment")
+	ErrRedirectURIMismatch  = errors.New("redirect_uri is not registered for this client")
+)
+
+// OAuthError is an error answered to a client in the RFC 6749 format: Code
+// is one of the registered error codes, Description is for the developer.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ResponseType        string `query:"response_type"`
+	ClientID            string `query:"client_id"`
+	RedirectURI         string `query:"redirect_uri"`
+	Scope               string `query:"scope"`
+	State               string `query:"state"`
+	Nonce               string `query:"nonce"`
+	CodeChallenge       string `query:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method"`
+}
+
+// TokenRequest holds the parameters of a token request. The client may also
+// authenticate with HTTP Basic instead of ClientID and ClientSecret.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+// TokenResponse is returned by the token endpoint.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// OIDCService is a minimal OpenID Connect provider for internal apps: the
+// authorization code flow with PKCE (S256 only), ID tokens signed with the
+// access token keys and a userinfo endpoint. Issuer is the public base URL
+// of this API; it names the provider in ID tokens and the discovery document.
+type OIDCService struct {
+	Repo   *repo.OAuthRepo
+	Users  *UserService
+	Tokens *TokenService
+	Issuer string
+}
+
+func NewOIDCService(r *repo.OAuthRepo, users *UserService, tokens *TokenService, issuer string) *OIDCService {
+	return &OIDCService{Repo: r, Users: users, Tokens: tokens, Issuer: strings.TrimRight(issuer, "/")}
+}
+
+// RegisterClient registers a client and returns it with its secret, which is
+// only ever returned here. Public clients get no secret.
+func (s *OIDCService) RegisterClient(name string, redirectURIs []string, confidential bool) (*models.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrOAuthClientNameEmpty
+	}
+	if len(redirectURIs) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" ||
+			strings.ContainsAny(uri, " \t\n") {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+	id, err := utils.RandomToken(12)
+	if err != nil {
+		return nil, "", err
+	}
+	client := models.OAuthClient{
+		ClientID:     OAuthClientPrefix + id,
+		Name:         name,
+		Confidential: confidential,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+	}
+	var secret string
+	if confidential {
+		if secret, err = utils.RandomToken(32); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+	if err := s.Repo.CreateClient(&client); err != nil {
+		return nil, "", err
+	}
+	return &client, secret, nil
+}
+
+func (s *OIDCService) GetClients() ([]models.OAuthClient, error) {
+	return s.Repo.GetClients()
+}
+
+func (s *OIDCService) DeleteClient(clientID string) error {
+	return s.Repo.DeleteClient(clientID)
+}
+
+// CheckClient looks up the client and checks redirectURI against it. Until
+// this passes, errors must be shown to the user rather than sent to the
+// redirect URI.
+func (s *OIDCService) CheckClient(clientID, redirectURI string) (*models.OAuthClient, error) {
+	client, err := s.Repo.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirectURI(redirectURI) {
+		return nil, ErrRedirectURIMismatch
+	}
+	return client, nil
+}
+
+// Authorize issues an authorization code for user, who authenticated at
+// authTime. The client and redirect URI must already have passed CheckClient.
+// Failures are *OAuthError, to be sent back to the client.
+func (s *OIDCService) Authorize(user *models.User, authTime time.Time, req *AuthorizeRequest) (string, error) {
+	if req.ResponseType != "code" {
+		return "", oauthError("unsupported_response_type", "only response_type=code is supported")
+	}
+	scopes := strings.Fields(req.Scope)
+	if !containsScope(scopes, models.ScopeOpenID) {
+		return "", oauthError("invalid_scope", "the openid scope is required")
+	}
+	granted, err := ResolveScopes(user.Role, scopes)
+	if err != nil {
+		return "", oauthError("invalid_scope", "a requested scope is not available to this user")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return "", oauthError("invalid_request", "PKCE is required: send an S256 code_challenge")
+	}
+	code, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	record := models.AuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(granted, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      authTime,
+		ExpiresAt:     now.Add(AuthCodeTTL),
+	}
+	if err := s.Repo.CreateAuthCode(&record); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange redeems an authorization code for an access token and an ID
+// token. Failures are *OAuthError; invalid_client means the client failed
+// to authenticate.
+func (s *OIDCService) Exchange(req *TokenRequest) (*TokenResponse, error) {
+	if req.GrantType != "authorization_code" {
+		return nil, oauthError("unsupported_grant_type", "only grant_type=authorization_code is supported")
+	}
+	client, err := s.Repo.GetClientByClientID(req.ClientID)
+	if errors.Is(err, repo.ErrOAuthClientNotFound) {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.Confidential && subtle.ConstantTimeCompare([]byte(utils.HashToken(req.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+
+	code, err := s.Repo.ConsumeAuthCode(utils.HashToken(req.Code), time.Now())
+	if errors.Is(err, repo.ErrAuthCodeInvalid) {
+		return nil, oauthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "the code was issued to another client or redirect_uri")
+	}
+	if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.Users.GetUserByID(code.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(code.Scope)
+	accessToken, err := s.Tokens.CreateAccessToken(user, scopes)
+	if errors.Is(err, ErrInvalidScope) {
+		// the user's role changed since they authorized
+		return nil, oauthError("invalid_grant", "a granted scope is no longer available to this user")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{Nonce: code.Nonce, AuthTime: code.AuthTime.Unix()}
+	claims.Issuer = s.Issuer
+	claims.Subject = strconv.Itoa(user.ID)
+	claims.Audience = []string{client.ClientID}
+	s.fillUserClaims(claims, user, scopes)
+	idToken, err := s.Tokens.CreateIDToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   s.Tokens.ExpiresInSeconds(),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims about user the granted scopes allow.
+func (s *OIDCService) UserInfo(userID int, scopes []string) (*IDTokenClaims, error) {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	claims := &IDTokenClaims{}
+	claims.Subject = strconv.Itoa(user.ID)
+	s.fillUserClaims(claims, user, scopes)
+	return claims, nil
+}
+
+func (s *OIDCService) fillUserClaims(claims *IDTokenClaims, user *models.User, scopes []string) {
+	if containsScope(scopes, models.ScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	if containsScope(scopes, models.ScopeProfile) {
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+		claims.Picture = user.ImgSrc
+	}
+}
+
+// RunCodeSweeper deletes expired authorization codes every interval. It
+// blocks, so start it in its own goroutine.
+func (s *OIDCService) RunCodeSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := s.Repo.DeleteExpiredAuthCodes(now); err != nil {
+			log.Printf("authorization code sweeper: %v", err)
+		}
+	}
+}
+
+// verifyPKCE checks an RFC 7636 code verifier against its S256 challenge.
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
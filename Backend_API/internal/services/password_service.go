@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/mailer"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MinPasswordLength = 6
+
+var ErrWeakPassword = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+
+// PasswordService runs the forgot/reset password flow.
+type PasswordService struct {
+	Users    *repo.UserRepo
+	Tokens   *repo.UserTokenRepo
+	TokenSvc *TokenService
+	Mailer   mailer.Mailer
+	ResetTTL time.Duration
+	ResetURL string // optional page that takes ?token=, linked from the email
+}
+
+func NewPasswordService(users *repo.UserRepo, tokens *repo.UserTokenRepo, ts *TokenService, m mailer.Mailer, resetTTL time.Duration, resetURL string) *PasswordService {
+	return &PasswordService{
+		Users:    users,
+		Tokens:   tokens,
+		TokenSvc: ts,
+		Mailer:   m,
+		ResetTTL: resetTTL,
+		ResetURL: resetURL,
+	}
+}
+
+// RequestReset emails a reset token to the account with this email. Unknown
+// emails are silently ignored so the endpoint cannot be used to find accounts.
+func (s *PasswordService) RequestReset(email string) error {
+	user, err := s.Users.GetUserByEmail(utils.NormalizeEmail(email))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	// only the newest reset email works
+	if err := s.Tokens.InvalidateTokens(user.ID, models.TokenPasswordReset); err != nil {
+		return err
+	}
+	record := models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPasswordReset,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(s.ResetTTL),
+	}
+	if err := s.Tokens.CreateToken(&record); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your bookstore account.\n\n"+
+		"Your reset token is:\n\n    %s\n\nIt expires in %d minutes and can be used once.\n",
+		user.FirstName, token, int(s.ResetTTL.Minutes()))
+	if s.ResetURL != "" {
+		body += fmt.Sprintf("\nOr open: %s?token=%s\n", s.ResetURL, token)
+	}
+	body += "\nIf you did not ask for this, you can ignore this email.\n"
+	return s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+// ResetPassword sets a new password for the owner of a valid reset token and
+// signs them out everywhere.
+func (s *PasswordService) ResetPassword(token string, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	userID, err := s.Tokens.ResetPassword(utils.HashToken(token), hashed)
+	if err != nil {
+		return err
+	}
+	return s.TokenSvc.RevokeUserSessions(userID)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	repo "first_task/go-fiber-api/internal/repository"
+	"sync"
+	"time"
+)
+
+// RevocationStore remembers access tokens that were invalidated before they
+// expired. Entries only need to live until the tokens they cover expire.
+type RevocationStore interface {
+	// RevokeToken invalidates the token with the given jti.
+	RevokeToken(jti string, expiresAt time.Time) error
+	// RevokeUser invalidates every token issued to userID at or before at.
+	RevokeUser(userID int, at time.Time, expiresAt time.Time) error
+	// IsRevoked reports whether a token with this jti, subject and issue time was revoked.
+	IsRevoked(jti string, userID int, issuedAt time.Time) (bool, error)
+	// Evict drops entries whose tokens have expired by now.
+	Evict(now time.Time) error
+}
+
+type userCutoff struct {
+	at        time.Time
+	expiresAt time.Time
+}
+
+// MemoryRevocationStore keeps revocations in process memory. They are lost on
+// restart and not shared between instances.
+type MemoryRevocationStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[int]userCutoff
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[int]userCutoff),
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(userID int, at time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = userCutoff{at: at, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string, userID int, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.tokens[jti]; ok && jti != "" {
+		return true, nil
+	}
+	if cut, ok := s.users[userID]; ok && !issuedAt.After(cut.at) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) Evict(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, jti)
+		}
+	}
+	for id, cut := range s.users {
+		if cut.expiresAt.Before(now) {
+			delete(s.users, id)
+		}
+	}
+	return nil
+}
+
+// DBRevocationStore keeps revocations in the database so they survive restarts
+// and are shared by every instance.
+type DBRevocationStore struct {
+	Repo *repo.RevocationRepo
+}
+
+func NewDBRevocationStore(r *repo.RevocationRepo) *DBRevocationStore {
+	return &DBRevocationStore{Repo: r}
+}
+
+func (s *DBRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	return s.Repo.RevokeToken(jti, expiresAt)
+}
+
+func (s *DBRevocationStore) RevokeUser(userID int, at time.Time, expiresAt time.Time) error {
+	return s.Repo.RevokeUser(userID, at, expiresAt)
+}
+
+func (s *DBRevocationStore) IsRevoked(jti string, userID int, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		revoked, err := s.Repo.IsTokenRevoked(jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	cut, err := s.Repo.GetUserRevocation(userID)
+	if err != nil || cut == nil {
+		return false, err
+	}
+	return !issuedAt.After(cut.RevokedAt), nil
+}
+
+func (s *DBRevocationStore) Evict(now time.Time) error {
+	return s.Repo.DeleteExpired(now)
+}
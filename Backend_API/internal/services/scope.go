@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+)
+
+var ErrInvalidScope = errors.New("invalid_scope")
+
+// ResolveScopes returns the scopes to grant a user with role: all the role
+// allows when none are requested, otherwise exactly the requested ones.
+// Asking for a scope the role does not allow yields ErrInvalidScope.
+func ResolveScopes(role string, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return models.RoleScopes(role), nil
+	}
+	seen := map[string]bool{}
+	granted := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !models.RoleAllowsScope(role, scope) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
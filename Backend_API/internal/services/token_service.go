@@ -1,49 +1,393 @@
 package services
 
 import (
+	"errors"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// TokenService manages JWT creation and related helpers.
+var (
+	ErrInvalidAccessToken  = errors.New("invalid or missing token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidMFAToken     = errors.New("invalid or expired mfa token")
+)
+
+// MFATokenTTL is how long a user has to enter their second factor after the password.
+const MFATokenTTL = 5 * time.Minute
+
+// ImpersonationTTL is how long an admin's impersonation token lasts.
+const ImpersonationTTL = 15 * time.Minute
+
+func init() {
+	// Tokens carry "iat" and "exp" in milliseconds, so a session revocation
+	// can tell tokens issued just before it from a login right after it.
+	jwt.TimePrecision = time.Millisecond
+}
+
+// Token types, carried in the "typ" claim. Access tokens have none.
+const (
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFAPending marks a token that only proves the password step of
+	// a login. It must never be accepted as an access token.
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+// Claims are the claims of every token TokenService issues: the registered
+// "sub" (user ID as a string), "iss", "aud", "jti", "iat" and "exp", plus the
+// user's role and space-separated "scope" on access tokens and the token
+// type on everything else. Impersonation tokens also name the acting admin
+// in "act" (RFC 8693).
+type Claims struct {
+	Role  string `json:"role,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	Type  string `json:"typ,omitempty"`
+	Act   *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is the party acting on behalf of the token's subject.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// ActorID returns the acting admin's user ID, or 0 when the token is not an
+// impersonation token.
+func (c *Claims) ActorID() int {
+	if c.Act == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(c.Act.Subject)
+	return id
+}
+
+// Scopes returns the token's scopes as a slice.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// UserID returns the subject as a user ID.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. Its audience is
+// the client, not this API, so it is never accepted as an access token.
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenConfig holds the keys, secrets and lifetimes used by TokenService.
+type TokenConfig struct {
+	Keys          *KeySet // signs access tokens
+	TTL           time.Duration
+	RefreshSecret string
+	RefreshTTL    time.Duration
+	Issuer        string
+	Audience      string
+}
+
+// TokenService is the only place tokens are issued, parsed and validated.
 type TokenService struct {
-	secret []byte
-	ttl    time.Duration
-	issuer string
+	keys          *KeySet
+	ttl           time.Duration
+	refreshSecret []byte
+	refreshTTL    time.Duration
+	issuer        string
+	audience      string
+	repo          *repo.TokenRepo
+	apiKeys       *repo.APIKeyRepo
+	revocations   RevocationStore
 }
 
 // NewTokenService creates a TokenService instance.
-func NewTokenService(secret string, ttl time.Duration, issuer string) *TokenService {
+func NewTokenService(cfg TokenConfig, r *repo.TokenRepo, apiKeys *repo.APIKeyRepo, revocations RevocationStore) *TokenService {
 	return &TokenService{
-		secret: []byte(secret),
-		ttl:    ttl,
-		issuer: issuer,
+		keys:          cfg.Keys,
+		ttl:           cfg.TTL,
+		refreshSecret: []byte(cfg.RefreshSecret),
+		refreshTTL:    cfg.RefreshTTL,
+		issuer:        cfg.Issuer,
+		audience:      cfg.Audience,
+		repo:          r,
+		apiKeys:       apiKeys,
+		revocations:   revocations,
 	}
 }
 
-// CreateAccessToken creates a signed HS256 token with common claims.
-// userID can be any identifier (int used here for example).
-// extra may include fields like "role", "name", etc.
-func (t *TokenService) CreateAccessToken(userID int, extra map[string]any) (string, error) {
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"iss": t.issuer,
-		"iat": now.Unix(),
-		"exp": now.Add(t.ttl).Unix(),
+// newClaims fills in the registered claims shared by every token type.
+func (t *TokenService) newClaims(userID int, jti string, now time.Time, ttl time.Duration) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    t.issuer,
+			Audience:  jwt.ClaimStrings{t.audience},
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// parse verifies a token's signature, issuer, audience and expiry.
+func (t *TokenService) parse(tokenString string, keyFunc jwt.Keyfunc) (*Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keyFunc,
+		jwt.WithIssuer(t.issuer), jwt.WithAudience(t.audience), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, err
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// CreateAccessToken issues an access token for user, signed by the key set.
+// It carries the requested scopes, or every scope of the user's role when
+// none are requested; scopes the role does not allow yield ErrInvalidScope.
+// Every token gets a random "jti" so it can be revoked on its own.
+func (t *TokenService) CreateAccessToken(user *models.User, scopes []string) (string, error) {
+	granted, err := ResolveScopes(user.Role, scopes)
+	if err != nil {
+		return "", err
+	}
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	claims := t.newClaims(user.ID, jti, time.Now(), t.ttl)
+	claims.Role = user.Role
+	claims.Scope = strings.Join(granted, " ")
+	return t.keys.Sign(claims)
+}
+
+// CreateImpersonationToken issues a short-lived access token for target on
+// behalf of the admin adminID. It has no refresh token.
+func (t *TokenService) CreateImpersonationToken(target *models.User, adminID int) (string, error) {
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	claims := t.newClaims(target.ID, jti, time.Now(), ImpersonationTTL)
+	claims.Role = target.Role
+	claims.Scope = strings.Join(models.RoleScopes(target.Role), " ")
+	claims.Act = &Actor{Subject: strconv.Itoa(adminID)}
+	return t.keys.Sign(claims)
+}
+
+// ParseAccessToken verifies an access token and returns its claims. Refresh
+// and mfa_pending tokens are refused.
+func (t *TokenService) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims, err := t.parse(tokenString, t.keys.Keyfunc)
+	if err != nil || claims.Type != "" || claims.ID == "" {
+		return nil, ErrInvalidAccessToken
 	}
+	return claims, nil
+}
 
-	// add optional extra claims in a safe way
-	for k, v := range extra {
-		if k == "sub" || k == "iss" || k == "iat" || k == "exp" {
-			continue
+// Authenticate parses an access token and checks it was not revoked since it
+// was issued. It returns ErrInvalidAccessToken or ErrTokenRevoked on failure.
+func (t *TokenService) Authenticate(tokenString string) (*Claims, error) {
+	claims, err := t.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := claims.UserID()
+	revoked, err := t.revocations.IsRevoked(claims.ID, userID, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// CreateRefreshToken issues a single-use refresh token for userID and records
+// its hashed jti. An empty familyID starts a new family (a new login); scopes
+// are those requested at that login and are reused on every rotation.
+func (t *TokenService) CreateRefreshToken(userID int, familyID string, scopes []string) (string, error) {
+	jti, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if familyID == "" {
+		if familyID, err = utils.RandomToken(32); err != nil {
+			return "", err
 		}
-		claims[k] = v
 	}
+	claims := t.newClaims(userID, jti, time.Now(), t.refreshTTL)
+	claims.Type = TokenTypeRefresh
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.refreshSecret)
+	if err != nil {
+		return "", err
+	}
+	record := models.RefreshToken{
+		ID:        utils.HashToken(jti),
+		UserID:    userID,
+		FamilyID:  familyID,
+		Scope:     strings.Join(scopes, " "),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := t.repo.CreateRefreshToken(&record); err != nil {
+		return "", err
+	}
+	return signed, nil
+}
+
+// CreateMFAToken issues the short-lived token returned after a correct
+// password when the user still has to pass the second factor. It remembers
+// the scopes requested at login for the access token issued afterwards.
+func (t *TokenService) CreateMFAToken(userID int, scopes []string) (string, error) {
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	claims := t.newClaims(userID, jti, time.Now(), MFATokenTTL)
+	claims.Type = TokenTypeMFAPending
+	claims.Scope = strings.Join(scopes, " ")
+	return t.keys.Sign(claims)
+}
+
+// ParseMFAToken verifies a token from CreateMFAToken and returns its user and
+// requested scopes.
+func (t *TokenService) ParseMFAToken(mfaToken string) (int, []string, error) {
+	claims, err := t.parse(mfaToken, t.keys.Keyfunc)
+	if err != nil || claims.Type != TokenTypeMFAPending {
+		return 0, nil, ErrInvalidMFAToken
+	}
+	userID, err := claims.UserID()
+	return userID, claims.Scopes(), err
+}
+
+// parseRefreshToken verifies a refresh token's signature and claims and returns its jti.
+func (t *TokenService) parseRefreshToken(refreshToken string) (string, error) {
+	claims, err := t.parse(refreshToken, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return t.refreshSecret, nil
+	})
+	if err != nil || claims.Type != TokenTypeRefresh || claims.ID == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	return claims.ID, nil
+}
+
+// RotateRefreshToken verifies a refresh token, consumes it and returns its
+// record (user and scopes) together with a replacement from the same family.
+// Presenting a token that was already rotated revokes the whole family, since
+// one of the copies was stolen.
+func (t *TokenService) RotateRefreshToken(refreshToken string) (*models.RefreshToken, string, error) {
+	jti, err := t.parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	record, err := t.repo.UseRefreshToken(utils.HashToken(jti))
+	if errors.Is(err, repo.ErrRefreshTokenReused) {
+		if err := t.repo.RevokeFamily(record.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", err
+	}
+	if errors.Is(err, repo.ErrRefreshTokenNotFound) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	next, err := t.CreateRefreshToken(record.UserID, record.FamilyID, strings.Fields(record.Scope))
+	if err != nil {
+		return nil, "", err
+	}
+	return record, next, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, ending the login it came from.
+func (t *TokenService) RevokeRefreshToken(refreshToken string) error {
+	jti, err := t.parseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	record, err := t.repo.GetRefreshToken(utils.HashToken(jti))
+	if errors.Is(err, repo.ErrRefreshTokenNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	return t.repo.RevokeFamily(record.FamilyID)
+}
+
+// RevokeAccessToken invalidates a single access token until it expires.
+func (t *TokenService) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return t.revocations.RevokeToken(jti, expiresAt)
+}
+
+// RevokeUserSessions invalidates every access and refresh token issued to the
+// user so far, and their API keys, which would otherwise outlive a password
+// reset or deletion. The cut-off has the millisecond precision of "iat", so
+// a token issued in the same millisecond is revoked too.
+func (t *TokenService) RevokeUserSessions(userID int) error {
+	now := time.Now().Truncate(jwt.TimePrecision)
+	if err := t.revocations.RevokeUser(userID, now, now.Add(t.ttl)); err != nil {
+		return err
+	}
+	if err := t.repo.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	return t.apiKeys.RevokeUserAPIKeys(userID)
+}
+
+// RunRevocationSweeper evicts revocations whose tokens have expired.
+// It blocks, so start it in its own goroutine.
+func (t *TokenService) RunRevocationSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := t.revocations.Evict(now); err != nil {
+			log.Printf("revocation sweeper: %v", err)
+		}
+	}
+}
+
+// CreateIDToken signs an ID token with the access token keys, so clients can
+// verify it against the JWKS. The caller fills in the issuer, subject,
+// audience and user claims; it expires with the access token it accompanies.
+func (t *TokenService) CreateIDToken(claims *IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(t.ttl))
+	return t.keys.Sign(claims)
+}
+
+// SigningAlg returns the algorithm access and ID tokens are signed with.
+func (t *TokenService) SigningAlg() string {
+	return t.keys.Alg()
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(t.secret)
+// JWKS returns the public keys that verify access tokens.
+func (t *TokenService) JWKS() JWKS {
+	return t.keys.JWKS()
 }
 
 // ExpiresInSeconds returns the TTL in seconds as an exported helper for other packages.
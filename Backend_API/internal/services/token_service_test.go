@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a gorm handle that builds statements without a server.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestTokenService(t *testing.T) *TokenService {
+	t.Helper()
+	db := dryRunDB(t)
+	return NewTokenService(TokenConfig{
+		Keys:          NewHMACKeySet("secret"),
+		TTL:           time.Hour,
+		RefreshSecret: "refresh-secret",
+		RefreshTTL:    time.Hour,
+		Issuer:        "test",
+		Audience:      "test-api",
+	}, &repo.TokenRepo{DB: db}, &repo.APIKeyRepo{DB: db}, NewMemoryRevocationStore())
+}
+
+func TestRevokeUserSessionsWithinOneSecond(t *testing.T) {
+	ts := newTestTokenService(t)
+	user := &models.User{ID: 1, Role: models.RoleMember}
+	other := &models.User{ID: 2, Role: models.RoleMember}
+
+	before, err := ts.CreateAccessToken(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untouched, err := ts.CreateAccessToken(other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.RevokeUserSessions(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Authenticate(before); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token issued just before the revocation: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := ts.Authenticate(untouched); err != nil {
+		t.Errorf("another user's token rejected: %v", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	after, err := ts.CreateAccessToken(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Authenticate(after); err != nil {
+		t.Errorf("login right after the revocation rejected: %v", err)
+	}
+}
+
+func TestMemoryRevocationStoreCutoff(t *testing.T) {
+	cut := time.Date(2025, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	store := NewMemoryRevocationStore()
+	if err := store.RevokeUser(1, cut, cut.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		userID   int
+		issuedAt time.Time
+		want     bool
+	}{
+		{"earlier in the same second", 1, cut.Add(-400 * time.Millisecond), true},
+		{"at the cut-off", 1, cut, true},
+		{"a millisecond later", 1, cut.Add(time.Millisecond), false},
+		{"other user", 2, cut.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.IsRevoked("", tt.userID, tt.issuedAt)
+			if err != nil || got != tt.want {
+				t.Errorf("IsRevoked = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeUserSessionsRevokesAPIKeys(t *testing.T) {
+	ts := newTestTokenService(t)
+	var updated []string
+	db := ts.apiKeys.DB
+	if err := db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		updated = append(updated, tx.Statement.SQL.String())
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.RevokeUserSessions(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range updated {
+		if strings.HasPrefix(sql, "UPDATE `api_keys` SET `revoked_at`=") && strings.Contains(sql, "WHERE user_id = ? AND revoked_at IS NULL") {
+			return
+		}
+	}
+	t.Errorf("API keys were not revoked, statements: %q", updated)
+}
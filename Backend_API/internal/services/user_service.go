@@ -1,10 +1,17 @@
 package services
 
 import (
+	"errors"
 	"first_task/go-fiber-api/internal/models"
 	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"net/mail"
+
+	"gorm.io/gorm"
 )
 
+var ErrInvalidEmail = errors.New("a valid email address is required")
+
 type UserService struct {
 	Repo *repo.UserRepo
 }
@@ -13,19 +20,59 @@ func NewUserService(r *repo.UserRepo) *UserService {
 	return &UserService{Repo: r}
 }
 func (s *UserService) CreateUser(user *models.User) error {
+	user.Email = utils.NormalizeEmail(user.Email)
+	if !validEmail(user.Email) {
+		return ErrInvalidEmail
+	}
 	return s.Repo.CreateUser(user)
 }
 
-func (s *UserService) GetAllUsers() ([]models.User, error) {
-	return s.Repo.GetAllUsers()
+// validEmail reports whether email is a bare address such as a@b.co, without
+// a display name or angle brackets.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func (s *UserService) GetAllUsers(includeDeleted bool) ([]models.User, error) {
+	return s.Repo.GetAllUsers(includeDeleted)
 }
 
 func (s *UserService) GetUserByID(id int) (*models.User, error) {
 	return s.Repo.GetUserByID(id)
 }
+func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
+	return s.Repo.GetUserByEmail(utils.NormalizeEmail(email))
+}
+
+// UpdateUser saves a user's profile. The email is the login, so it must be a
+// plain valid address; changing it clears its verification.
 func (s *UserService) UpdateUser(user *models.User) error {
+	user.Email = utils.NormalizeEmail(user.Email)
+	if !validEmail(user.Email) {
+		return ErrInvalidEmail
+	}
+	current, err := s.Repo.GetUserByID(user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return repo.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = current.EmailVerifiedAt
+	if user.Email != current.Email {
+		user.EmailVerifiedAt = nil
+	}
 	return s.Repo.UpdateUser(user)
 }
+func (s *UserService) DeleteUser(id int) error {
+	return s.Repo.DeleteUser(id)
+}
+
+func (s *UserService) RestoreUser(id int) error {
+	return s.Repo.RestoreUser(id)
+}
+
 func (s *UserService) GetAllPublishersWithBookCount() ([]models.PublisherWithCount, error) {
 	return s.Repo.GetAllPublishersWithBookCount()
 }
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"first_task/go-fiber-api/internal/mailer"
+	"first_task/go-fiber-api/internal/models"
+	repo "first_task/go-fiber-api/internal/repository"
+	utils "first_task/go-fiber-api/pkg"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAlreadyVerified = errors.New("email address already verified")
+
+// ResendTooSoonError is returned when a verification email was sent less than
+// the cooldown ago.
+type ResendTooSoonError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResendTooSoonError) Error() string {
+	return fmt.Sprintf("verification email already sent, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// VerificationService confirms that users own the email they signed up with.
+type VerificationService struct {
+	Users     *repo.UserRepo
+	Tokens    *repo.UserTokenRepo
+	Mailer    mailer.Mailer
+	TTL       time.Duration
+	Cooldown  time.Duration
+	VerifyURL string // e.g. http://localhost:3000/api/verify-email
+}
+
+func NewVerificationService(users *repo.UserRepo, tokens *repo.UserTokenRepo, m mailer.Mailer, ttl time.Duration, cooldown time.Duration, verifyURL string) *VerificationService {
+	return &VerificationService{
+		Users:     users,
+		Tokens:    tokens,
+		Mailer:    m,
+		TTL:       ttl,
+		Cooldown:  cooldown,
+		VerifyURL: verifyURL,
+	}
+}
+
+// SendVerification emails the user a link that verifies their address.
+// Earlier links stop working.
+func (s *VerificationService) SendVerification(user *models.User) error {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := s.Tokens.InvalidateTokens(user.ID, models.TokenEmailVerify); err != nil {
+		return err
+	}
+	record := models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenEmailVerify,
+		TokenHash: utils.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(s.TTL),
+	}
+	if err := s.Tokens.CreateToken(&record); err != nil {
+		return err
+	}
+	link := s.VerifyURL + "?token=" + url.QueryEscape(token)
+	return s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening:\n\n    %s\n\nThe link expires in %d hours.\n",
+			user.FirstName, link, int(s.TTL.Hours())),
+	})
+}
+
+// Resend sends a new verification email unless the user is already verified
+// or the previous email went out less than Cooldown ago.
+func (s *VerificationService) Resend(userID int) error {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	last, err := s.Tokens.GetLatestToken(userID, models.TokenEmailVerify)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		if wait := s.Cooldown - time.Since(last.CreatedAt); wait > 0 {
+			return &ResendTooSoonError{RetryAfter: wait}
+		}
+	}
+	return s.SendVerification(user)
+}
+
+// Verify consumes a verification token and marks its user's email as verified.
+// The token only counts for the address it was sent to: after the user
+// changes their email, links sent to the old address are invalid.
+func (s *VerificationService) Verify(token string) error {
+	record, err := s.Tokens.ConsumeToken(utils.HashToken(token), models.TokenEmailVerify)
+	if err != nil {
+		return err
+	}
+	err = s.Users.MarkEmailVerified(record.UserID, record.Email, time.Now())
+	if errors.Is(err, repo.ErrEmailChanged) {
+		return repo.ErrUserTokenInvalid
+	}
+	return err
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"first_task/go-fiber-api/internal/db"
 	"first_task/go-fiber-api/internal/handlers"
+	"first_task/go-fiber-api/internal/mailer"
 	"first_task/go-fiber-api/internal/middleware"
 	"first_task/go-fiber-api/internal/models"
 	repo "first_task/go-fiber-api/internal/repository"
+	"first_task/go-fiber-api/internal/search"
 	"first_task/go-fiber-api/internal/services"
 	utils "first_task/go-fiber-api/pkg"
 
@@ -33,28 +36,136 @@ func main() {
 		panic("Failed to connect to database")
 	}
 
-	database.AutoMigrate(&models.Book{}, &models.User{})
+	database.AutoMigrate(&models.Book{}, &models.User{}, &models.Loan{}, &models.Hold{}, &models.LedgerEntry{}, &models.RefreshToken{},
+		&models.RevokedToken{}, &models.SessionRevocation{}, &models.UserToken{}, &models.RecoveryCode{}, &models.APIKey{},
+		&models.AuditLog{}, &models.OAuthClient{}, &models.AuthorizationCode{})
+	// emails used to be unique among deleted users too; idx_users_live_email replaces that index
+	if database.Migrator().HasIndex(&models.User{}, "idx_users_email") {
+		if err := database.Migrator().DropIndex(&models.User{}, "idx_users_email"); err != nil {
+			log.Fatalf("could not drop the old email index: %v", err)
+		}
+	}
 
 	bookRepo := &repo.BookRepo{DB: database}
 	userRepo := &repo.UserRepo{DB: database}
+	loanRepo := &repo.LoanRepo{DB: database}
+	holdRepo := &repo.HoldRepo{DB: database}
+	ledgerRepo := &repo.LedgerRepo{DB: database}
+	tokenRepo := &repo.TokenRepo{DB: database}
+	revocationRepo := &repo.RevocationRepo{DB: database}
+	userTokenRepo := &repo.UserTokenRepo{DB: database}
+	mfaRepo := &repo.MFARepo{DB: database}
+	apiKeyRepo := &repo.APIKeyRepo{DB: database}
+	auditRepo := &repo.AuditRepo{DB: database}
+	oauthRepo := &repo.OAuthRepo{DB: database}
+
+	loanPolicy := services.LoanPolicy{
+		LoanPeriod:  cfg.LoanPeriod,
+		MaxRenewals: cfg.MaxRenewals,
+		HoldPeriod:  cfg.HoldPeriod,
 
-	bookService := services.NewBookService(bookRepo)
+		FinePerDayCents:   cfg.FinePerDayCents,
+		FineCapCents:      cfg.FineCapCents,
+		BalanceBlockCents: cfg.BalanceBlockCents,
+	}
+
+	// catalog search uses the books table's FULLTEXT index unless the in-process index is chosen
+	var searcher search.Searcher = search.MySQLSearcher{Books: bookRepo}
+	if cfg.SearchDriver == "memory" {
+		index := search.NewMemorySearcher()
+		books, err := bookRepo.GetAllBooks()
+		if err != nil {
+			log.Fatalf("could not load books into the search index: %v", err)
+		}
+		for i := range books {
+			index.Index(&books[i])
+		}
+		searcher = index
+	}
+
+	bookService := services.NewBookService(bookRepo, ledgerRepo, loanPolicy, searcher)
 	userService := services.NewUserService(userRepo)
+	loanService := services.NewLoanService(loanRepo, loanPolicy)
+	holdService := services.NewHoldService(holdRepo, loanPolicy)
+	ledgerService := services.NewLedgerService(ledgerRepo)
+	mfaService := services.NewMFAService(userRepo, mfaRepo, "Bookstore")
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo)
+	auditService := services.NewAuditService(auditRepo)
+	loginGuard := services.NewLoginGuard(userRepo, services.LockoutPolicy{
+		MaxAttempts:   cfg.LoginMaxAttempts,
+		IPMaxAttempts: cfg.LoginIPMaxAttempts,
+		Lockout:       cfg.LoginLockout,
+		MaxLockout:    cfg.LoginMaxLockout,
+	})
+	go loginGuard.RunSweeper(10 * time.Minute)
 
-	tokenService := services.NewTokenService(cfg.JWTSecret, cfg.JWTTTL, "my-go-api")
+	// flag overdue loans and expire unclaimed holds in the background while the server runs
+	go loanService.RunOverdueSweeper(cfg.OverdueSweepInterval)
+	go holdService.RunExpirySweeper(cfg.HoldSweepInterval)
+
+	// revoked tokens live in memory by default; "db" shares them across instances and restarts
+	var revocations services.RevocationStore = services.NewMemoryRevocationStore()
+	if cfg.RevocationStore == "db" {
+		revocations = services.NewDBRevocationStore(revocationRepo)
+	}
+	// access tokens are signed with JWT_SECRET unless an asymmetric key is configured
+	keys := services.NewHMACKeySet(cfg.JWTSecret)
+	if cfg.JWTSigningKeyFile != "" {
+		keys, err = services.LoadKeySet(cfg.JWTSigningKeyFile, cfg.JWTVerifyKeyFiles)
+		if err != nil {
+			log.Fatalf("could not load JWT signing keys: %v", err)
+		}
+	}
+	tokenService := services.NewTokenService(services.TokenConfig{
+		Keys:          keys,
+		TTL:           cfg.JWTTTL,
+		RefreshSecret: cfg.JWTRefreshSecret,
+		RefreshTTL:    cfg.JWTRefreshTTL,
+		Issuer:        cfg.JWTIssuer,
+		Audience:      cfg.JWTAudience,
+	}, tokenRepo, apiKeyRepo, revocations)
+	go tokenService.RunRevocationSweeper(time.Hour)
+	// OpenID Connect provider for internal apps, identified by the API's public URL
+	oidcService := services.NewOIDCService(oauthRepo, userService, tokenService, cfg.AppBaseURL)
+	go oidcService.RunCodeSweeper(10 * time.Minute)
+
+	// account emails go to the log unless an SMTP server (or local stand-in) is configured
+	var mail mailer.Mailer = mailer.LogMailer{}
+	if cfg.MailDriver == "smtp" {
+		mail = mailer.SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.MailFrom, Username: cfg.SMTPUser, Password: cfg.SMTPPass}
+	}
+	passwordService := services.NewPasswordService(userRepo, userTokenRepo, tokenService, mail, cfg.PasswordResetTTL, cfg.PasswordResetURL)
+	verificationService := services.NewVerificationService(userRepo, userTokenRepo, mail,
+		cfg.VerifyEmailTTL, cfg.VerifyResendCooldown, cfg.AppBaseURL+"/api/verify-email")
 
 	bookHandler := handlers.NewBookHandler(bookService)
-	userHandler := handlers.NewUserHandler(userService)
+	userHandler := handlers.NewUserHandler(userService, tokenService, verificationService)
+	loanHandler := handlers.NewLoanHandler(loanService)
+	holdHandler := handlers.NewHoldHandler(holdService)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService, userService)
 
-	authHandler := handlers.NewAuthHandler(tokenService, userService)
+	authHandler := handlers.NewAuthHandler(tokenService, userService, mfaService, loginGuard, middleware.SessionCookies{
+		Secure:   cfg.SessionCookieSecure,
+		SameSite: cfg.SessionCookieSameSite,
+		Domain:   cfg.SessionCookieDomain,
+	})
+	adminHandler := handlers.NewAdminHandler(tokenService, userService, auditService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, cfg.OIDCLoginURL)
+	passwordHandler := handlers.NewPasswordHandler(passwordService)
+	verificationHandler := handlers.NewVerificationHandler(verificationService)
+	mfaHandler := handlers.NewMFAHandler(mfaService, userService, loginGuard)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
 
 	app := fiber.New(fiber.Config{
 		AppName: "MyFiberApp",
 	})
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*", // allow requests from this origin
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "*",
+		AllowOrigins: cfg.CORSAllowedOrigins, // allow requests from these origins
+		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization," + middleware.CSRFHeader +
+			",HX-Request,HX-Current-URL,HX-Target,HX-Trigger,HX-Trigger-Name",
+		// cookies (the session mode) can only be sent to explicitly listed origins
+		AllowCredentials: cfg.CORSAllowedOrigins != "*",
 	}))
 	app.Use(logger.New())
 
@@ -62,34 +173,96 @@ func main() {
 		return c.SendString("ok")
 	})
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
+	app.Get("/.well-known/openid-configuration", oidcHandler.Discovery)
 	app.Options("/*", func(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusNoContent)
 	})
 	api := app.Group("/api")
 
-	//JWT middleware
-	jwtMiddleware := middleware.NewJWT(cfg.JWTSecret)
+	//JWT middleware, also accepts "Authorization: ApiKey ..." and audits impersonated requests
+	jwtMiddleware := middleware.NewJWT(tokenService, apiKeyService, userService, auditService)
+	// only enforced when REQUIRE_VERIFIED_EMAIL=true
+	verifiedEmail := middleware.RequireVerifiedEmail(userService, cfg.RequireVerifiedEmail)
+	ownLogin := middleware.RequireOwnLogin()
+	// scopes the caller's token or API key must carry, answered with 403 insufficient_scope
+	booksRead := middleware.RequireScope(models.ScopeBooksRead)
+	booksWrite := middleware.RequireScope(models.ScopeBooksWrite)
+	loansRead := middleware.RequireScope(models.ScopeLoansRead)
+	loansWrite := middleware.RequireScope(models.ScopeLoansWrite)
+	usersRead := middleware.RequireScope(models.ScopeUsersRead)
+	usersWrite := middleware.RequireScope(models.ScopeUsersWrite)
+	usersAdmin := middleware.RequireScope(models.ScopeUsersAdmin)
 
 	api.Post("/signup", userHandler.Signup)
 	api.Post("/login", authHandler.Login)
+	api.Post("/login/mfa", authHandler.LoginMFA)
+	api.Post("/token/refresh", authHandler.Refresh)
+	api.Post("/logout", jwtMiddleware, authHandler.Logout)
+	api.Post("/password/forgot", passwordHandler.ForgotPassword)
+	api.Post("/password/reset", passwordHandler.ResetPassword)
+	api.Get("/verify-email", verificationHandler.VerifyEmail)
+	api.Post("/verify-email/resend", jwtMiddleware, verificationHandler.ResendVerification)
+
+	admin := api.Group("/admin", jwtMiddleware, middleware.RequireRole(models.RoleAdmin), usersAdmin)
+	admin.Post("/users/:id/revoke-sessions", authHandler.RevokeUserSessions)
+	admin.Post("/users/:id/unlock", authHandler.UnlockUser)
+	admin.Post("/users/:id/2fa/reset", mfaHandler.ResetUserMFA)
+	admin.Post("/impersonate/:userId", adminHandler.Impersonate)
+	admin.Get("/audit-log", adminHandler.GetAuditLog)
+	admin.Get("/oauth/clients", oidcHandler.ListClients)
+	admin.Post("/oauth/clients", oidcHandler.RegisterClient)
+	admin.Delete("/oauth/clients/:clientId", oidcHandler.DeleteClient)
+
+	// OpenID Connect provider: authorization code flow with PKCE
+	api.Get("/oauth/authorize", oidcHandler.RequireLogin, jwtMiddleware, oidcHandler.Authorize)
+	api.Post("/oauth/token", oidcHandler.Token)
+	api.Get("/oauth/userinfo", jwtMiddleware, middleware.RequireScope(models.ScopeOpenID), oidcHandler.UserInfo)
+	api.Post("/oauth/userinfo", jwtMiddleware, middleware.RequireScope(models.ScopeOpenID), oidcHandler.UserInfo)
 
 	books := api.Group("/books", jwtMiddleware)
 	//books := api.Group("/books")
-	books.Post("/", bookHandler.CreateBook)
-	books.Get("/", bookHandler.GetAllBooks)
-	books.Get("/:id", bookHandler.GetBookByID)
-	books.Post("/:id/checkin", bookHandler.Checkin)
-	books.Post("/:id/checkout", bookHandler.Checkout)
+	books.Post("/", middleware.RequireRole(models.RolePublisher, models.RoleAdmin), booksWrite, verifiedEmail, bookHandler.CreateBook)
+	books.Get("/", booksRead, bookHandler.GetAllBooks)
+	books.Get("/search", booksRead, bookHandler.SearchBooks)
+	books.Get("/:id", booksRead, bookHandler.GetBookByID)
+	books.Put("/:id", middleware.RequireRole(models.RolePublisher, models.RoleAdmin), booksWrite, bookHandler.UpdateBook)
+	books.Patch("/:id", middleware.RequireRole(models.RolePublisher, models.RoleAdmin), booksWrite, bookHandler.UpdateBook)
+	books.Delete("/:id", middleware.RequireRole(models.RolePublisher, models.RoleAdmin), booksWrite, bookHandler.DeleteBook)
+	books.Post("/:id/restore", middleware.RequireRole(models.RoleAdmin), booksWrite, bookHandler.RestoreBook)
+	books.Post("/:id/checkin", loansWrite, bookHandler.Checkin)
+	books.Post("/:id/checkout", loansWrite, verifiedEmail, bookHandler.Checkout)
+	books.Get("/:id/loans", middleware.RequireRole(models.RoleAdmin), loansRead, loanHandler.GetBookLoans)
+	books.Post("/:id/holds", loansWrite, holdHandler.CreateHold)
+	books.Get("/:id/holds", middleware.RequireRole(models.RoleAdmin), loansRead, holdHandler.GetBookHolds)
+
+	loans := api.Group("/loans", jwtMiddleware)
+	loans.Get("/overdue", middleware.RequireRole(models.RoleAdmin), loansRead, loanHandler.GetOverdueLoans)
+	loans.Post("/:id/renew", loansWrite, loanHandler.RenewLoan)
+
+	holds := api.Group("/holds", jwtMiddleware)
+	holds.Delete("/:id", loansWrite, holdHandler.CancelHold)
 
 	users := api.Group("/users")
 	//usersProtected := users.Group("")
 	usersProtected := users.Group("", jwtMiddleware)
-	usersProtected.Get("/", userHandler.GetAllUsers)
-	usersProtected.Get("/profile", authHandler.Profile)
-	usersProtected.Get("/publishers", userHandler.GetAllPublishersWithoutBooks)
-	usersProtected.Get("/:id", userHandler.GetUserByID)
-	usersProtected.Put("/:id", userHandler.UpdateUser)
-	users.Post("/", userHandler.CreateUser) //foradmins
+	usersProtected.Get("/", middleware.RequireRole(models.RoleAdmin), usersAdmin, userHandler.GetAllUsers)
+	usersProtected.Post("/", middleware.RequireRole(models.RoleAdmin), usersAdmin, userHandler.CreateUser)
+	usersProtected.Get("/profile", usersRead, authHandler.Profile)
+	usersProtected.Post("/me/2fa", usersWrite, ownLogin, mfaHandler.EnrollMFA)
+	usersProtected.Post("/me/2fa/confirm", usersWrite, ownLogin, mfaHandler.ConfirmMFA)
+	usersProtected.Get("/me/api-keys", usersRead, apiKeyHandler.ListAPIKeys)
+	usersProtected.Post("/me/api-keys", usersWrite, apiKeyHandler.CreateAPIKey)
+	usersProtected.Delete("/me/api-keys/:id", usersWrite, apiKeyHandler.RevokeAPIKey)
+	usersProtected.Get("/publishers", booksRead, userHandler.GetAllPublishersWithoutBooks)
+	usersProtected.Get("/:id", usersRead, userHandler.GetUserByID)
+	usersProtected.Get("/:id/loans", loansRead, loanHandler.GetUserLoans)
+	usersProtected.Get("/:id/holds", loansRead, holdHandler.GetUserHolds)
+	usersProtected.Get("/:id/balance", usersRead, ledgerHandler.GetBalance)
+	usersProtected.Post("/:id/payments", middleware.RequireRole(models.RoleAdmin), usersAdmin, ledgerHandler.RecordPayment)
+	usersProtected.Put("/:id", usersWrite, userHandler.UpdateUser)
+	usersProtected.Delete("/:id", middleware.RequireRole(models.RoleAdmin), usersAdmin, userHandler.DeleteUser)
+	usersProtected.Post("/:id/restore", middleware.RequireRole(models.RoleAdmin), usersAdmin, userHandler.RestoreUser)
 	//start server
 	log.Fatal(app.Listen(":3000"))
 }
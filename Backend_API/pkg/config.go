@@ -4,15 +4,34 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	JWTSecret string
-	JWTTTL    time.Duration
+	JWTSecret        string
+	JWTTTL           time.Duration
+	JWTRefreshSecret string
+	JWTRefreshTTL    time.Duration
+	RevocationStore  string // "memory" or "db"
+	JWTIssuer        string
+	JWTAudience      string
+
+	JWTSigningKeyFile string   // PKCS#8 PEM (Ed25519 or RSA); empty signs with JWT_SECRET (HS256)
+	JWTVerifyKeyFiles []string // PEM public keys of retired signing keys
+
+	SessionCookieSecure   bool
+	SessionCookieSameSite string
+	SessionCookieDomain   string
+	CORSAllowedOrigins    string // comma separated, "*" allows any origin without credentials
+
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+
 	DBUser    string
 	DBPass    string
 	DBHost    string
@@ -21,6 +40,32 @@ type Config struct {
 	DBCharset string
 	AppPort   string
 	Env       string
+
+	AppBaseURL       string
+	MailDriver       string // "log" or "smtp"
+	SMTPAddr         string
+	SMTPUser         string
+	SMTPPass         string
+	MailFrom         string
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+	OIDCLoginURL     string // front-end login page signed-out users are sent to by /api/oauth/authorize
+
+	RequireVerifiedEmail bool
+	VerifyEmailTTL       time.Duration
+	VerifyResendCooldown time.Duration
+
+	LoanPeriod           time.Duration
+	MaxRenewals          int
+	OverdueSweepInterval time.Duration
+	HoldPeriod           time.Duration
+	HoldSweepInterval    time.Duration
+
+	FinePerDayCents   int
+	FineCapCents      int
+	BalanceBlockCents int
+
+	SearchDriver string // "mysql" or "memory"
 }
 
 func LoadConfig() *Config {
@@ -28,15 +73,56 @@ func LoadConfig() *Config {
 	if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
+	// there are no built-in secrets, startup fails instead of signing with a guessable key
 	secret := os.Getenv("JWT_SECRET")
+	signingKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if secret == "" && signingKeyFile == "" {
+		log.Fatal("JWT_SECRET (or JWT_SIGNING_KEY_FILE) must be set")
+	}
 
-	ttl := 72 * time.Hour // ttl yaane time to live
-	if v := os.Getenv("JWT_TTL_HOURS"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			ttl = time.Duration(n) * time.Hour
+	ttl := envDuration("JWT_TTL_HOURS", time.Hour, 72*time.Hour) // ttl yaane time to live
+	refreshSecret := os.Getenv("JWT_REFRESH_SECRET")
+	if refreshSecret == "" {
+		log.Fatal("JWT_REFRESH_SECRET must be set")
+	}
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "my-go-api"
+	}
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = "bookstore-api"
+	}
+	revocationStore := os.Getenv("REVOCATION_STORE")
+	if revocationStore == "" {
+		revocationStore = "memory"
+	}
+	refreshTTL := envDuration("JWT_REFRESH_TTL_HOURS", time.Hour, 7*24*time.Hour)
+
+	var verifyKeyFiles []string
+	for _, f := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			verifyKeyFiles = append(verifyKeyFiles, f)
 		}
 	}
 
+	// cookie sessions for the web front-end
+	cookieSecure := os.Getenv("SESSION_COOKIE_SECURE") != "false"
+	cookieSameSite := os.Getenv("SESSION_COOKIE_SAMESITE")
+	if cookieSameSite == "" {
+		cookieSameSite = "Lax"
+	}
+	corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if corsOrigins == "" {
+		corsOrigins = "*"
+	}
+
+	// failed logins before an account or a client IP is locked out
+	loginMaxAttempts := envInt("LOGIN_MAX_ATTEMPTS", 5, 1)
+	loginIPMaxAttempts := envInt("LOGIN_IP_MAX_ATTEMPTS", 20, 1)
+	loginLockout := envDuration("LOGIN_LOCKOUT_MINUTES", time.Minute, time.Minute)
+	loginMaxLockout := envDuration("LOGIN_MAX_LOCKOUT_MINUTES", time.Minute, time.Hour)
+
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
 	dbHost := os.Getenv("DB_HOST")
@@ -55,10 +141,67 @@ func LoadConfig() *Config {
 	if env == "" {
 		env = "development"
 	}
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + appPort
+	}
+
+	mailDriver := os.Getenv("MAIL_DRIVER")
+	if mailDriver == "" {
+		mailDriver = "log"
+	}
+	smtpAddr := os.Getenv("SMTP_ADDR")
+	if smtpAddr == "" {
+		smtpAddr = "localhost:1025" // MailHog / Mailpit default
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "no-reply@bookstore.local"
+	}
+	resetTTL := envDuration("PASSWORD_RESET_TTL_MINUTES", time.Minute, 30*time.Minute)
+
+	loanPeriod := envDuration("LOAN_PERIOD_DAYS", 24*time.Hour, 14*24*time.Hour)
+	maxRenewals := envInt("LOAN_MAX_RENEWALS", 2, 0)
+	sweepInterval := envDuration("OVERDUE_SWEEP_MINUTES", time.Minute, 15*time.Minute)
+	holdPeriod := envDuration("HOLD_PICKUP_DAYS", 24*time.Hour, 3*24*time.Hour)
+	holdSweepInterval := envDuration("HOLD_SWEEP_MINUTES", time.Minute, 15*time.Minute)
+
+	// fines are kept in cents to avoid float rounding
+	finePerDay := envInt("FINE_PER_DAY_CENTS", 25, 0)
+	fineCap := envInt("FINE_CAP_CENTS", 1000, 0)
+	balanceBlock := envInt("BALANCE_BLOCK_CENTS", 500, 0)
+
+	searchDriver := os.Getenv("SEARCH_DRIVER")
+	if searchDriver == "" {
+		searchDriver = "mysql"
+	}
+
+	requireVerified := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	verifyTTL := envDuration("VERIFY_EMAIL_TTL_HOURS", time.Hour, 48*time.Hour)
+	resendCooldown := time.Duration(envInt("VERIFY_RESEND_COOLDOWN_MINUTES", 5, 0)) * time.Minute
 
 	return &Config{
-		JWTSecret: secret,
-		JWTTTL:    ttl,
+		JWTSecret:        secret,
+		JWTTTL:           ttl,
+		JWTRefreshSecret: refreshSecret,
+		JWTRefreshTTL:    refreshTTL,
+		RevocationStore:  revocationStore,
+		JWTIssuer:        issuer,
+		JWTAudience:      audience,
+
+		JWTSigningKeyFile: signingKeyFile,
+		JWTVerifyKeyFiles: verifyKeyFiles,
+
+		SessionCookieSecure:   cookieSecure,
+		SessionCookieSameSite: cookieSameSite,
+		SessionCookieDomain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+		CORSAllowedOrigins:    corsOrigins,
+
+		LoginMaxAttempts:   loginMaxAttempts,
+		LoginIPMaxAttempts: loginIPMaxAttempts,
+		LoginLockout:       loginLockout,
+		LoginMaxLockout:    loginMaxLockout,
+
 		DBUser:    dbUser,
 		DBPass:    dbPass,
 		DBHost:    dbHost,
@@ -67,56 +210,51 @@ func LoadConfig() *Config {
 		DBCharset: dbCharset,
 		AppPort:   appPort,
 		Env:       env,
+
+		AppBaseURL:       baseURL,
+		MailDriver:       mailDriver,
+		SMTPAddr:         smtpAddr,
+		SMTPUser:         os.Getenv("SMTP_USER"),
+		SMTPPass:         os.Getenv("SMTP_PASS"),
+		MailFrom:         mailFrom,
+		PasswordResetTTL: resetTTL,
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+		OIDCLoginURL:     os.Getenv("OIDC_LOGIN_URL"),
+
+		RequireVerifiedEmail: requireVerified,
+		VerifyEmailTTL:       verifyTTL,
+		VerifyResendCooldown: resendCooldown,
+
+		LoanPeriod:           loanPeriod,
+		MaxRenewals:          maxRenewals,
+		OverdueSweepInterval: sweepInterval,
+		HoldPeriod:           holdPeriod,
+		HoldSweepInterval:    holdSweepInterval,
+
+		FinePerDayCents:   finePerDay,
+		FineCapCents:      fineCap,
+		BalanceBlockCents: balanceBlock,
+
+		SearchDriver: searchDriver,
 	}
 }
 
-// GenerateTokens generates a new access and refresh JWT token for a user.
-func GenerateTokens(userID int, email string) (string, string, error) {
-	accessSecret := os.Getenv("JWT_SECRET")
-	refreshSecret := os.Getenv("JWT_REFRESH_SECRET")
-	if accessSecret == "" {
-		accessSecret = "default_access_secret"
-	}
-	if refreshSecret == "" {
-		refreshSecret = "default_refresh_secret"
-	}
-	ttl := 72 * time.Hour // ttl yaane time to live
-	if v := os.Getenv("JWT_TTL_HOURS"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			ttl = time.Duration(n) * time.Hour
+// envInt reads a whole number from the environment variable name. It falls
+// back to def when the variable is unset, not a number or below min.
+func envInt(name string, def, min int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= min {
+			return n
 		}
 	}
-	// Access token
-	//NewWithClaims does the following:
-	// 	Creates JWT object token li ha hteja bl auth.
-	//  Attaches ll claims (payload data) ana bde hutta bl token.
-	//  Prepares it to be signed later with a secret key.
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   strconv.Itoa(int(userID)), //"sub" usaully mnhutta user ID
-		"email": email,
-		"exp":   time.Now().Add(ttl).Unix(), //when does it expire
-		"iat":   time.Now().Unix(),          // when it was created
-	})
-	//singedstring does the following:
-	//Signs the JWT with a secret key or private key.
-
-	//Generates the final JWT string that you can send to clients.
-
-	accessTokenString, err := accessToken.SignedString([]byte(accessSecret))
-	if err != nil {
-		return "", "", err
-	}
+	return def
+}
 
-	// Refresh token
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": strconv.Itoa(int(userID)),
-		"exp": time.Now().Add(ttl * 24 * 7).Unix(),
-		"iat": time.Now().Unix(),
-	})
-	refreshTokenString, err := refreshToken.SignedString([]byte(refreshSecret))
-	if err != nil {
-		return "", "", err
+// envDuration reads a positive number of units, e.g. LOAN_PERIOD_DAYS, from
+// the environment variable name, falling back to def.
+func envDuration(name string, unit, def time.Duration) time.Duration {
+	if n := envInt(name, 0, 1); n > 0 {
+		return time.Duration(n) * unit
 	}
-
-	return accessTokenString, refreshTokenString, nil
+	return def
 }
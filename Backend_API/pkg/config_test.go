@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		value string
+		min   int
+		want  int
+	}{
+		{"", 0, 7},
+		{"3", 0, 3},
+		{"0", 0, 0},
+		{"0", 1, 7},
+		{"-2", 0, 7},
+		{"ten", 0, 7},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_ENV_INT", tt.value)
+		if got := envInt("TEST_ENV_INT", 7, tt.min); got != tt.want {
+			t.Errorf("envInt(%q, min %d) = %d, want %d", tt.value, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Hour},
+		{"3", 3 * 24 * time.Hour},
+		{"0", time.Hour},
+		{"1.5", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_ENV_DAYS", tt.value)
+		if got := envDuration("TEST_ENV_DAYS", 24*time.Hour, time.Hour); got != tt.want {
+			t.Errorf("envDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}